@@ -17,6 +17,7 @@ package logdog
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 )
 
 // ConfigLoader is an interface which con load map[string]interface{} config
@@ -31,6 +32,7 @@ type Config map[string]interface{}
 type LogConfig struct {
 	DisableExistingLoggers bool                              `json:"disableExistingLoggers"`
 	Formatters             map[string]map[string]interface{} `json:"formatters"`
+	Filters                map[string]map[string]interface{} `json:"filters"`
 	Handlers               map[string]map[string]interface{} `json:"handlers"`
 	Loggers                map[string]map[string]interface{} `json:"loggers"`
 }
@@ -83,14 +85,52 @@ func LoadJSONConfig(config []byte) error {
 		}
 	}
 
-	if logConfig.Handlers != nil {
-		for name, conf := range logConfig.Handlers {
+	if logConfig.Filters != nil {
+		for name, conf := range logConfig.Filters {
 			temp, err := builder(name, conf)
 			if err != nil {
 				return err
 			}
-			handler := temp.(Handler)
-			RegisterHandler(name, handler)
+			filter, ok := temp.(Filter)
+			if !ok {
+				return fmt.Errorf("%s is not a filter", name)
+			}
+			RegisterFilter(name, filter)
+		}
+	}
+
+	if logConfig.Handlers != nil {
+		// a handler may refer to another handler by "target",
+		// e.g. MemoryHandler, it should be built after its target
+		pending := make(map[string]map[string]interface{}, len(logConfig.Handlers))
+		for name, conf := range logConfig.Handlers {
+			pending[name] = conf
+		}
+		for len(pending) > 0 {
+			progress := false
+			for name, conf := range pending {
+				if target, ok := conf["target"].(string); ok {
+					if _, waiting := pending[target]; waiting && target != name {
+						continue
+					}
+				}
+				temp, err := builder(name, conf)
+				if err != nil {
+					return err
+				}
+				handler := temp.(Handler)
+				RegisterHandler(name, handler)
+				delete(pending, name)
+				progress = true
+			}
+			if !progress {
+				names := make([]string, 0, len(pending))
+				for name := range pending {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				return fmt.Errorf("circular target reference among handlers: %v", names)
+			}
 		}
 	}
 
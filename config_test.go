@@ -52,3 +52,50 @@ func TestLoadJSONConfig(t *testing.T) {
 	assert.NotNil(t, GetLogger("app"))
 
 }
+
+func TestLoadJSONConfigCircularTarget(t *testing.T) {
+	config := []byte(`{
+        "handlers": {
+            "circular1": {
+                "class": "NullHandler",
+                "target": "circular2"
+            },
+            "circular2": {
+                "class": "NullHandler",
+                "target": "circular1"
+            }
+        }
+    }`)
+
+	err := LoadJSONConfig(config)
+	assert.EqualError(t, err, "circular target reference among handlers: [circular1 circular2]")
+}
+
+func TestLoadJSONConfigHierarchy(t *testing.T) {
+	config := []byte(`{
+        "handlers": {
+            "hierarchyNull": {
+                "class": "NullHandler"
+            }
+        },
+        "loggers": {
+            "config": {
+                "level": "WARN",
+                "handlers": ["hierarchyNull"],
+                "propagate": false
+            },
+            "config.db": {
+                "handlers": ["hierarchyNull"]
+            }
+        }
+    }`)
+
+	err := LoadJSONConfig(config)
+	assert.Nil(t, err)
+	app, db := GetLogger("config"), GetLogger("config.db")
+	assert.False(t, app.Propagate)
+	assert.True(t, db.Propagate)
+	assert.Equal(t, app, db.Parent())
+	assert.Equal(t, NothingLevel, db.Level)
+	assert.Equal(t, WarnLevel, db.EffectiveLevel())
+}
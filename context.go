@@ -0,0 +1,172 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"context"
+	"sort"
+)
+
+type contextKey struct{}
+
+// ContextExtractor extracts fields from a context, e.g. trace id,
+// they are merged into records logged by the Ctx log functions
+type ContextExtractor func(ctx context.Context) Fields
+
+// RegisterContextExtractor binds name and ContextExtractor,
+// extractors are called in the order of their names
+func RegisterContextExtractor(name string, extractor ContextExtractor) {
+	extractors.Register(name, extractor)
+}
+
+// ContextValueExtractor returns a ContextExtractor which extracts
+// the value of key in context as field
+func ContextValueExtractor(field string, key interface{}) ContextExtractor {
+	return func(ctx context.Context) Fields {
+		v := ctx.Value(key)
+		if v == nil {
+			return nil
+		}
+		return Fields{field: v}
+	}
+}
+
+// ExtractFields calls all registered ContextExtractor with ctx
+// and merges the fields they return
+func ExtractFields(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+
+	names := extractors.Keys()
+	sort.Strings(names)
+
+	var fields Fields
+	for _, name := range names {
+		v, ok := extractors.Get(name)
+		if !ok {
+			continue
+		}
+		for k, value := range v.(ContextExtractor)(ctx) {
+			if fields == nil {
+				fields = Fields{}
+			}
+			fields[k] = value
+		}
+	}
+	return fields
+}
+
+// NewContext returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or root if there is none
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*Logger); ok && logger != nil {
+			return logger
+		}
+	}
+	return root
+}
+
+// logContext is the true logging function of Ctx log functions,
+// fields extracted from ctx are overridden by bound fields and
+// fields passed to the call
+func (lg *Logger) logContext(ctx context.Context, level Level, msg string, args ...interface{}) {
+	if !lg.Enabled(level) {
+		return
+	}
+	record := lg.makeRecord(level, msg, args...)
+	if fields := ExtractFields(ctx); len(fields) > 0 {
+		for k, v := range record.Fields {
+			fields[k] = v
+		}
+		record.Fields = fields
+	}
+	lg.Handle(record)
+}
+
+// LogfCtx is a context-aware Logf
+func (lg Logger) LogfCtx(ctx context.Context, level Level, msg string, args ...interface{}) {
+	lg.logContext(ctx, level, msg, args...)
+}
+
+// LogCtx is a context-aware Log
+func (lg Logger) LogCtx(ctx context.Context, level Level, args ...interface{}) {
+	lg.logContext(ctx, level, "", args...)
+}
+
+// DebugCtx is a context-aware Debug
+func (lg Logger) DebugCtx(ctx context.Context, args ...interface{}) {
+	lg.logContext(ctx, DebugLevel, "", args...)
+}
+
+// InfoCtx is a context-aware Info
+func (lg Logger) InfoCtx(ctx context.Context, args ...interface{}) {
+	lg.logContext(ctx, InfoLevel, "", args...)
+}
+
+// WarnCtx is a context-aware Warn
+func (lg Logger) WarnCtx(ctx context.Context, args ...interface{}) {
+	lg.logContext(ctx, WarnLevel, "", args...)
+}
+
+// ErrorCtx is a context-aware Error
+func (lg Logger) ErrorCtx(ctx context.Context, args ...interface{}) {
+	lg.logContext(ctx, ErrorLevel, "", args...)
+}
+
+// NoticeCtx is a context-aware Notice
+func (lg Logger) NoticeCtx(ctx context.Context, args ...interface{}) {
+	lg.logContext(ctx, NoticeLevel, "", args...)
+}
+
+// FatalCtx is a context-aware Fatal
+func (lg Logger) FatalCtx(ctx context.Context, args ...interface{}) {
+	lg.logContext(ctx, FatalLevel, "", args...)
+}
+
+// DebugCtx logs with the logger carried by ctx
+func DebugCtx(ctx context.Context, args ...interface{}) {
+	FromContext(ctx).logContext(ctx, DebugLevel, "", args...)
+}
+
+// InfoCtx logs with the logger carried by ctx
+func InfoCtx(ctx context.Context, args ...interface{}) {
+	FromContext(ctx).logContext(ctx, InfoLevel, "", args...)
+}
+
+// WarnCtx logs with the logger carried by ctx
+func WarnCtx(ctx context.Context, args ...interface{}) {
+	FromContext(ctx).logContext(ctx, WarnLevel, "", args...)
+}
+
+// ErrorCtx logs with the logger carried by ctx
+func ErrorCtx(ctx context.Context, args ...interface{}) {
+	FromContext(ctx).logContext(ctx, ErrorLevel, "", args...)
+}
+
+// NoticeCtx logs with the logger carried by ctx
+func NoticeCtx(ctx context.Context, args ...interface{}) {
+	FromContext(ctx).logContext(ctx, NoticeLevel, "", args...)
+}
+
+// FatalCtx logs with the logger carried by ctx
+func FatalCtx(ctx context.Context, args ...interface{}) {
+	FromContext(ctx).logContext(ctx, FatalLevel, "", args...)
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type traceKey struct{}
+
+type tenantKey struct{}
+
+func init() {
+	RegisterContextExtractor("test.trace", ContextValueExtractor("trace_id", traceKey{}))
+	RegisterContextExtractor("test.tenant", func(ctx context.Context) Fields {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+			return Fields{"tenant": tenant, "user": "from context"}
+		}
+		return nil
+	})
+}
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, root, FromContext(context.Background()))
+
+	hdlr := &recordHandler{}
+	logger := NewLogger(OptionName("ctx"), OptionHandlers(hdlr))
+	ctx := NewContext(context.Background(), logger)
+	assert.Equal(t, logger, FromContext(ctx))
+
+	ctx = context.WithValue(ctx, traceKey{}, "trace-1")
+	ctx = context.WithValue(ctx, tenantKey{}, "acme")
+
+	InfoCtx(ctx, "from package")
+	logger.With(Fields{"user": "bound"}).WarnCtx(ctx, "from logger", Fields{"n": 1})
+	logger.LogfCtx(ctx, ErrorLevel, "%s", "formatted", Fields{"user": "call"})
+	logger.InfoCtx(context.Background(), "no context fields")
+
+	assert.Equal(t, []string{"from package", "from logger", "formatted", "no context fields"}, hdlr.messages)
+	assert.Equal(t, Fields{"trace_id": "trace-1", "tenant": "acme", "user": "from context"}, hdlr.records[0].Fields)
+	// bound fields and call fields override context fields
+	assert.Equal(t, Fields{"trace_id": "trace-1", "tenant": "acme", "user": "bound", "n": 1}, hdlr.records[1].Fields)
+	assert.Equal(t, Fields{"trace_id": "trace-1", "tenant": "acme", "user": "call"}, hdlr.records[2].Fields)
+	assert.Nil(t, hdlr.records[3].Fields)
+
+	// runtime info points to the caller
+	logger.Info("without context")
+	for _, record := range hdlr.records {
+		assert.Equal(t, "context_test.go", record.FileName)
+		assert.Equal(t, "TestContext", record.ShortFuncName)
+	}
+}
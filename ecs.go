@@ -0,0 +1,179 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zoumo/logdog/pkg/pythonic"
+)
+
+const (
+	// ECSVersion is the version of Elastic Common Schema used by ECSFormatter
+	ECSVersion = "1.6.0"
+	// DefaultTraceIDKey is the default field key of trace id
+	DefaultTraceIDKey = "trace_id"
+	// DefaultSpanIDKey is the default field key of span id
+	DefaultSpanIDKey = "span_id"
+)
+
+// ECSFormatter converts LogRecord to JSON in Elastic Common Schema (ECS)
+// like ecs-logging, e.g.
+//
+//	{"@timestamp":"2017-01-02T03:04:05.006Z","log.level":"info","message":"hello",
+//	 "ecs.version":"1.6.0","log.logger":"app","log.origin.file.name":"main.go",...}
+//
+// Fields are written as labels.*, nested maps and objects are flattened
+// with '_' since keys of labels can not contain dots. Fields with key
+// TraceIDKey and SpanIDKey are written as trace.id and span.id.
+type ECSFormatter struct {
+	// TraceIDKey is DefaultTraceIDKey if it is empty
+	TraceIDKey string
+	// SpanIDKey is DefaultSpanIDKey if it is empty
+	SpanIDKey string
+	ConfigLoader
+}
+
+// NewECSFormatter returns an ECSFormatter with default config
+func NewECSFormatter() *ECSFormatter {
+	return &ECSFormatter{
+		TraceIDKey: DefaultTraceIDKey,
+		SpanIDKey:  DefaultSpanIDKey,
+	}
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (ef *ECSFormatter) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	ef.TraceIDKey = config.MustGetString("traceIdKey", DefaultTraceIDKey)
+	ef.SpanIDKey = config.MustGetString("spanIdKey", DefaultSpanIDKey)
+	return nil
+}
+
+// Format converts the specified record to ECS JSON
+func (ef *ECSFormatter) Format(record *LogRecord) (string, error) {
+	data := map[string]interface{}{
+		"@timestamp":  record.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		"log.level":   strings.ToLower(record.LevelName),
+		"message":     record.GetMessage(),
+		"ecs.version": ECSVersion,
+		"process.pid": record.Process,
+	}
+	if record.Hostname != "" {
+		data["host.hostname"] = record.Hostname
+	}
+	if record.Name != "" {
+		data["log.logger"] = record.Name
+	}
+	if record.Line > 0 {
+		data["log.origin.file.name"] = record.FileName
+		data["log.origin.file.line"] = record.Line
+		data["log.origin.function"] = record.FuncName
+	}
+	if err := record.Error; err != nil {
+		data["error.message"] = err.Error()
+		data["error.type"] = errorType(err)
+	}
+	if record.Stack != "" {
+		data["error.stack_trace"] = record.Stack
+	}
+
+	traceIDKey, spanIDKey := traceKeys(ef.TraceIDKey, ef.SpanIDKey)
+	labels := map[string]string{}
+	eachField(record.Fields, record.TypedFields, func(f Field) {
+		switch f.Key {
+		case traceIDKey:
+			data["trace.id"] = fieldText(f)
+		case spanIDKey:
+			data["span.id"] = fieldText(f)
+		default:
+			addLabel(labels, "", f)
+		}
+	})
+	if len(labels) > 0 {
+		data["labels"] = labels
+	}
+
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("Marashal fields to Json failed, [%v]", err)
+	}
+	return string(jsonBytes), nil
+}
+
+// traceKeys returns the field keys of trace id and span id,
+// defaults are used if they are empty
+func traceKeys(traceIDKey, spanIDKey string) (string, string) {
+	if traceIDKey == "" {
+		traceIDKey = DefaultTraceIDKey
+	}
+	if spanIDKey == "" {
+		spanIDKey = DefaultSpanIDKey
+	}
+	return traceIDKey, spanIDKey
+}
+
+// fieldText returns the value of f as text
+func fieldText(f Field) string {
+	return string(f.appendText(nil))
+}
+
+// addLabel adds f to labels with key prefixed, dots in key are replaced
+// with '_', maps and objects are flattened
+func addLabel(labels map[string]string, prefix string, f Field) {
+	if f.Type == SkipType {
+		return
+	}
+	key := prefix + strings.Replace(f.Key, ".", "_", -1)
+	if f.Type == ObjectType {
+		enc := &labelEncoder{labels: labels, prefix: key + "_"}
+		if err := f.Interface.(ObjectMarshaler).MarshalLogObject(enc); err != nil {
+			enc.AddField(NamedErr("error", err))
+		}
+		return
+	}
+	if m, ok := stringMap(f.Interface); ok && f.Type == AnyType {
+		eachField(m, nil, func(nested Field) {
+			addLabel(labels, key+"_", nested)
+		})
+		return
+	}
+	labels[key] = fieldText(f)
+}
+
+// labelEncoder adds fields of a nested object to labels
+type labelEncoder struct {
+	labels map[string]string
+	prefix string
+}
+
+func (enc *labelEncoder) AddField(f Field) {
+	addLabel(enc.labels, enc.prefix, f)
+}
+
+func init() {
+	RegisterConstructor("ECSFormatter", func() ConfigLoader {
+		return NewECSFormatter()
+	})
+
+	RegisterFormatter("ecs", NewECSFormatter())
+}
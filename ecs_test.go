@@ -0,0 +1,87 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestECSFormatter(t *testing.T) {
+	record := NewLogRecord("app", WarnLevel, "/path/main.go", "main.main", 42, "hello",
+		Fields{
+			"a":        1,
+			"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+			"span_id":  "00f067aa0ba902b7",
+			"http.url": "/",
+			"nested":   Fields{"b": true},
+			"m":        map[string]int{"x": 1},
+		},
+		Object("user", user{1, "jim"}),
+		Err(errors.New("boom")),
+	)
+	record.Time = time.Date(2017, 1, 2, 3, 4, 5, 6000000, time.FixedZone("CST", 8*3600))
+	record.Process = 100
+	record.Hostname = "host"
+
+	text, err := NewECSFormatter().Format(record)
+	assert.Nil(t, err)
+	var data map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(text), &data))
+	assert.Equal(t, map[string]interface{}{
+		"@timestamp":           "2017-01-01T19:04:05.006Z",
+		"log.level":            "warn",
+		"log.logger":           "app",
+		"log.origin.file.name": "main.go",
+		"log.origin.file.line": float64(42),
+		"log.origin.function":  "main.main",
+		"message":              "hello",
+		"ecs.version":          ECSVersion,
+		"process.pid":          float64(100),
+		"host.hostname":        "host",
+		"error.message":        "boom",
+		"error.type":           "*errors.errorString",
+		"trace.id":             "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span.id":              "00f067aa0ba902b7",
+		"labels": map[string]interface{}{
+			"a":         "1",
+			"error":     "boom",
+			"http_url":  "/",
+			"m_x":       "1",
+			"nested_b":  "true",
+			"user_id":   "1",
+			"user_name": "jim",
+		},
+	}, data)
+
+	formatter := NewECSFormatter()
+	assert.Nil(t, formatter.LoadConfig(Config{"traceIdKey": "trace"}))
+	record = NewLogRecord("", InfoLevel, "??", "??", 0, "ok", Fields{"trace": "abc", "trace_id": "x"})
+	text, _ = formatter.Format(record)
+	data = nil
+	assert.Nil(t, json.Unmarshal([]byte(text), &data))
+	assert.Equal(t, "abc", data["trace.id"])
+	assert.Equal(t, map[string]interface{}{"trace_id": "x"}, data["labels"])
+	assert.NotContains(t, data, "log.origin.file.name")
+	assert.NotContains(t, data, "log.logger")
+
+	assert.Implements(t, (*Formatter)(nil), formatter)
+	_, ok := GetFormatter("ecs").(*ECSFormatter)
+	assert.True(t, ok)
+}
@@ -0,0 +1,498 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldType tells how the value of a Field is stored and encoded
+type FieldType uint8
+
+const (
+	// SkipType is a Field ignored by formatters, e.g. Err(nil)
+	SkipType FieldType = iota
+	// StringType is a Field holding a string in String
+	StringType
+	// Int64Type is a Field holding an int64 in Integer
+	Int64Type
+	// Uint64Type is a Field holding an uint64 in Integer
+	Uint64Type
+	// Float64Type is a Field holding the bits of a float64 in Integer
+	Float64Type
+	// BoolType is a Field holding a bool in Integer
+	BoolType
+	// DurationType is a Field holding a time.Duration in Integer
+	DurationType
+	// TimeType is a Field holding a time.Time as Unix nanoseconds in
+	// Integer and its *time.Location in Interface, times out of the
+	// range of UnixNano are held in Interface as time.Time
+	TimeType
+	// ErrorType is a Field holding an error in Interface
+	ErrorType
+	// StringerType is a Field holding a fmt.Stringer in Interface
+	StringerType
+	// ObjectType is a Field holding an ObjectMarshaler in Interface
+	ObjectType
+	// AnyType is a Field holding any value in Interface,
+	// it is encoded by reflection
+	AnyType
+)
+
+// Field is a typed key-value pair attached to a LogRecord.
+//
+// Unlike Fields, typed fields keep the order they are passed in
+// and formatters encode them without reflection, except Any.
+// They are passed at the end of args of logging calls, e.g.
+//
+//	logger.Info("request done", logdog.String("path", path), logdog.Duration("elapsed", d))
+type Field struct {
+	Key       string
+	Type      FieldType
+	Integer   int64
+	String    string
+	Interface interface{}
+}
+
+// ObjectEncoder is used by ObjectMarshaler to add fields of the object
+type ObjectEncoder interface {
+	AddField(f Field)
+}
+
+// ObjectMarshaler is implemented by types which can encode themselves
+// as a nested object of typed fields
+type ObjectMarshaler interface {
+	MarshalLogObject(enc ObjectEncoder) error
+}
+
+// ObjectMarshalerFunc is an adapter to allow the use of
+// ordinary functions as ObjectMarshaler
+type ObjectMarshalerFunc func(enc ObjectEncoder) error
+
+// MarshalLogObject calls f(enc)
+func (f ObjectMarshalerFunc) MarshalLogObject(enc ObjectEncoder) error {
+	return f(enc)
+}
+
+// String returns a Field with a string value
+func String(key string, value string) Field {
+	return Field{Key: key, Type: StringType, String: value}
+}
+
+// Int returns a Field with an int value
+func Int(key string, value int) Field {
+	return Int64(key, int64(value))
+}
+
+// Int64 returns a Field with an int64 value
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Type: Int64Type, Integer: value}
+}
+
+// Uint64 returns a Field with an uint64 value
+func Uint64(key string, value uint64) Field {
+	return Field{Key: key, Type: Uint64Type, Integer: int64(value)}
+}
+
+// Float64 returns a Field with a float64 value
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Type: Float64Type, Integer: int64(math.Float64bits(value))}
+}
+
+// Bool returns a Field with a bool value
+func Bool(key string, value bool) Field {
+	var i int64
+	if value {
+		i = 1
+	}
+	return Field{Key: key, Type: BoolType, Integer: i}
+}
+
+// Duration returns a Field with a time.Duration value,
+// it is encoded as text like 1.5s
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Type: DurationType, Integer: int64(value)}
+}
+
+// Time returns a Field with a time.Time value,
+// the monotonic clock reading of value is dropped
+func Time(key string, value time.Time) Field {
+	nanos := value.UnixNano()
+	if !time.Unix(0, nanos).Equal(value) {
+		// out of the range of int64 nanoseconds
+		return Field{Key: key, Type: TimeType, Interface: value}
+	}
+	return Field{Key: key, Type: TimeType, Integer: nanos, Interface: value.Location()}
+}
+
+// Err returns a Field with key "error", it is skipped if err is nil
+func Err(err error) Field {
+	return NamedErr("error", err)
+}
+
+// NamedErr returns a Field with an error value, it is skipped if err is nil
+func NamedErr(key string, err error) Field {
+	if err == nil {
+		return Field{Key: key, Type: SkipType}
+	}
+	return Field{Key: key, Type: ErrorType, Interface: err}
+}
+
+// Stringer returns a Field with the value of value.String(),
+// which is called only if the field is encoded
+func Stringer(key string, value fmt.Stringer) Field {
+	return Field{Key: key, Type: StringerType, Interface: value}
+}
+
+// Object returns a Field with a nested object
+func Object(key string, value ObjectMarshaler) Field {
+	return Field{Key: key, Type: ObjectType, Interface: value}
+}
+
+// Any returns a Field with value, it chooses the typed Field for
+// known types and falls back to reflection for others
+func Any(key string, value interface{}) Field {
+	switch v := value.(type) {
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int8:
+		return Int64(key, int64(v))
+	case int16:
+		return Int64(key, int64(v))
+	case int32:
+		return Int64(key, int64(v))
+	case int64:
+		return Int64(key, v)
+	case uint:
+		return Uint64(key, uint64(v))
+	case uint8:
+		return Uint64(key, uint64(v))
+	case uint16:
+		return Uint64(key, uint64(v))
+	case uint32:
+		return Uint64(key, uint64(v))
+	case uint64:
+		return Uint64(key, v)
+	case float32:
+		return Float64(key, float64(v))
+	case float64:
+		return Float64(key, v)
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	case ObjectMarshaler:
+		return Object(key, v)
+	case error:
+		return NamedErr(key, v)
+	case Fields, map[string]interface{}, json.Marshaler:
+		// checked before fmt.Stringer, so they are encoded
+		// as JSON objects instead of their String()
+		return Field{Key: key, Type: AnyType, Interface: value}
+	case fmt.Stringer:
+		return Stringer(key, v)
+	}
+	return Field{Key: key, Type: AnyType, Interface: value}
+}
+
+// Value returns the value of field as interface{},
+// nested objects are returned as Fields
+func (f Field) Value() interface{} {
+	switch f.Type {
+	case StringType:
+		return f.String
+	case Int64Type:
+		return f.Integer
+	case Uint64Type:
+		return uint64(f.Integer)
+	case Float64Type:
+		return math.Float64frombits(uint64(f.Integer))
+	case BoolType:
+		return f.Integer == 1
+	case DurationType:
+		return time.Duration(f.Integer)
+	case TimeType:
+		return f.time()
+	case ObjectType:
+		fields := Fields{}
+		if err := f.Interface.(ObjectMarshaler).MarshalLogObject(mapEncoder(fields)); err != nil {
+			fields["error"] = err
+		}
+		return fields
+	}
+	return f.Interface
+}
+
+// appendText appends the value of field as text to b
+func (f Field) appendText(b []byte) []byte {
+	switch f.Type {
+	case StringType:
+		return append(b, f.String...)
+	case Int64Type:
+		return strconv.AppendInt(b, f.Integer, 10)
+	case Uint64Type:
+		return strconv.AppendUint(b, uint64(f.Integer), 10)
+	case Float64Type:
+		return strconv.AppendFloat(b, math.Float64frombits(uint64(f.Integer)), 'g', -1, 64)
+	case BoolType:
+		return strconv.AppendBool(b, f.Integer == 1)
+	case DurationType:
+		return append(b, time.Duration(f.Integer).String()...)
+	case TimeType:
+		// auto format time to RFC3339
+		return f.time().AppendFormat(b, time.RFC3339)
+	case ErrorType:
+		return append(b, f.Interface.(error).Error()...)
+	case StringerType:
+		return append(b, f.Interface.(fmt.Stringer).String()...)
+	case ObjectType:
+		return appendObject(b, f.Interface.(ObjectMarshaler), false)
+	}
+	return append(b, fmt.Sprintf("%+v", f.Interface)...)
+}
+
+// appendJSON appends the value of field as JSON to b
+func (f Field) appendJSON(b []byte) []byte {
+	switch f.Type {
+	case StringType:
+		return appendJSONString(b, f.String)
+	case Int64Type:
+		return strconv.AppendInt(b, f.Integer, 10)
+	case Uint64Type:
+		return strconv.AppendUint(b, uint64(f.Integer), 10)
+	case Float64Type:
+		return appendJSONFloat(b, math.Float64frombits(uint64(f.Integer)))
+	case BoolType:
+		return strconv.AppendBool(b, f.Integer == 1)
+	case DurationType:
+		return appendJSONString(b, time.Duration(f.Integer).String())
+	case TimeType:
+		b = append(b, '"')
+		b = f.time().AppendFormat(b, time.RFC3339Nano)
+		return append(b, '"')
+	case ErrorType:
+		return appendJSONString(b, f.Interface.(error).Error())
+	case StringerType:
+		return appendJSONString(b, f.Interface.(fmt.Stringer).String())
+	case ObjectType:
+		return appendObject(b, f.Interface.(ObjectMarshaler), true)
+	}
+	data, err := json.Marshal(f.Interface)
+	if err != nil {
+		return appendJSONString(b, fmt.Sprintf("%+v", f.Interface))
+	}
+	return append(b, data...)
+}
+
+// time returns the value of a field of TimeType
+func (f Field) time() time.Time {
+	if loc, ok := f.Interface.(*time.Location); ok {
+		return time.Unix(0, f.Integer).In(loc)
+	}
+	t, _ := f.Interface.(time.Time)
+	return t
+}
+
+// appendJSONFloat appends v as a JSON number formatted like
+// encoding/json does, NaN and Inf are not valid in JSON so
+// they are appended as strings
+func appendJSONFloat(b []byte, v float64) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return appendJSONString(b, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	abs := math.Abs(v)
+	format := byte('f')
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	n := len(b)
+	b = strconv.AppendFloat(b, v, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		if m := len(b) - n; m >= 4 && b[len(b)-4] == 'e' && b[len(b)-3] == '-' && b[len(b)-2] == '0' {
+			b[len(b)-2] = b[len(b)-1]
+			b = b[:len(b)-1]
+		}
+	}
+	return b
+}
+
+// appendObject appends the nested object encoded as text
+// like {k1=v1 k2=v2} or JSON to b
+func appendObject(b []byte, obj ObjectMarshaler, asJSON bool) []byte {
+	enc := &fieldEncoder{buf: append(b, '{'), json: asJSON}
+	if err := obj.MarshalLogObject(enc); err != nil {
+		enc.AddField(NamedErr("error", err))
+	}
+	return append(enc.buf, '}')
+}
+
+// fieldEncoder encodes fields as text like k1=v1 k2=v2 or
+// JSON members like "k1":v1,"k2":v2
+type fieldEncoder struct {
+	buf   []byte
+	json  bool
+	count int
+	// color and endColor wrap values encoded as text
+	color, endColor string
+}
+
+// AddField encodes f, fields of SkipType are ignored
+func (enc *fieldEncoder) AddField(f Field) {
+	if f.Type == SkipType {
+		return
+	}
+	if enc.json {
+		if enc.count > 0 {
+			enc.buf = append(enc.buf, ',')
+		}
+		enc.buf = appendJSONString(enc.buf, f.Key)
+		enc.buf = append(enc.buf, ':')
+		enc.buf = f.appendJSON(enc.buf)
+	} else {
+		if enc.count > 0 {
+			enc.buf = append(enc.buf, ' ')
+		}
+		enc.buf = append(enc.buf, f.Key...)
+		enc.buf = append(enc.buf, '=')
+		enc.buf = append(enc.buf, enc.color...)
+		enc.buf = f.appendText(enc.buf)
+		enc.buf = append(enc.buf, enc.endColor...)
+	}
+	enc.count++
+}
+
+// encode encodes fields sorted by key, then typed fields in order.
+// Keys in fields shadowed by typed fields are skipped.
+func (enc *fieldEncoder) encode(fields Fields, typed []Field) {
+	eachField(fields, typed, enc.AddField)
+}
+
+// eachField calls fn with fields sorted by key as typed fields,
+// then typed fields in order. Keys in fields shadowed by typed
+// fields are skipped.
+func eachField(fields Fields, typed []Field, fn func(Field)) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		if !hasTypedField(typed, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fn(Any(k, fields[k]))
+	}
+	for _, f := range typed {
+		fn(f)
+	}
+}
+
+func hasTypedField(typed []Field, key string) bool {
+	for _, f := range typed {
+		if f.Key == key && f.Type != SkipType {
+			return true
+		}
+	}
+	return false
+}
+
+// stringMap returns v as map[string]interface{} if it is
+// a map with string keys, e.g. Fields or map[string]int
+func stringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case Fields:
+		return m, true
+	case map[string]interface{}:
+		return m, true
+	case nil:
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(map[string]interface{}, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+// mapEncoder collects fields of a nested object into Fields
+type mapEncoder Fields
+
+func (enc mapEncoder) AddField(f Field) {
+	if f.Type != SkipType {
+		enc[f.Key] = f.Value()
+	}
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString appends s as a quoted JSON string to b,
+// invalid UTF-8 is replaced with U+FFFD like encoding/json does
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `�`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
@@ -0,0 +1,234 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	id   int
+	name string
+}
+
+func (u user) MarshalLogObject(enc ObjectEncoder) error {
+	enc.AddField(Int("id", u.id))
+	enc.AddField(String("name", u.name))
+	return nil
+}
+
+func TestExtractTypedFields(t *testing.T) {
+	record := NewLogRecord(name, level, pathname, fun, line, "%s", "msg",
+		String("b", "x"), Fields{"a": 1}, Int("c", 2), Fields{"d": 3})
+
+	assert.Equal(t, []interface{}{"msg"}, record.Args)
+	assert.Equal(t, []Field{String("b", "x"), Int("c", 2)}, record.TypedFields)
+	assert.Equal(t, Fields{"a": 1, "d": 3}, record.Fields)
+	assert.Equal(t, "msg", record.GetMessage())
+
+	// fields should be at the end
+	record = NewLogRecord(name, level, pathname, fun, line, "%s %s", String("a", "b"), "msg")
+	assert.Nil(t, record.TypedFields)
+	assert.Len(t, record.Args, 2)
+}
+
+func TestFieldValue(t *testing.T) {
+	// the monotonic clock reading is not kept by Time
+	now := time.Now().Round(0)
+	err := errors.New("boom")
+	for _, c := range []struct {
+		field Field
+		value interface{}
+	}{
+		{String("k", "v"), "v"},
+		{Int("k", -1), int64(-1)},
+		{Uint64("k", math.MaxUint64), uint64(math.MaxUint64)},
+		{Float64("k", 1.5), 1.5},
+		{Bool("k", true), true},
+		{Duration("k", time.Second), time.Second},
+		{Time("k", now), now},
+		{Err(err), err},
+		{Object("k", user{1, "jim"}), Fields{"id": int64(1), "name": "jim"}},
+		{Any("k", []int{1}), []int{1}},
+	} {
+		assert.Equal(t, c.value, c.field.Value())
+	}
+
+	assert.Equal(t, Int("k", 1), Any("k", 1))
+	assert.Equal(t, Duration("k", time.Second), Any("k", time.Second))
+	assert.Equal(t, Object("k", user{}), Any("k", user{}))
+	// Fields is a fmt.Stringer, but it should be encoded as an object
+	assert.Equal(t, AnyType, Any("k", Fields{"a": 1}).Type)
+	assert.Equal(t, AnyType, Any("k", map[string]interface{}{"a": 1}).Type)
+	assert.Equal(t, AnyType, Any("k", json.RawMessage(`{}`)).Type)
+	assert.Equal(t, SkipType, Err(nil).Type)
+}
+
+func TestRecordFields(t *testing.T) {
+	record := NewLogRecord(name, level, pathname, fun, line, "", "msg",
+		Fields{"a": 1, "b": 2}, Int("b", 3), Err(nil))
+
+	v, ok := record.GetField("b")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), v)
+	v, ok = record.GetField("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	_, ok = record.GetField("error")
+	assert.False(t, ok)
+
+	assert.Equal(t, Fields{"a": 1, "b": int64(3)}, record.AllFields())
+}
+
+func TestFormatTypedFields(t *testing.T) {
+	tm := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	record := NewLogRecord(name, level, pathname, fun, line, "", "msg",
+		Fields{"a": 1, "z": "shadowed"},
+		String("z", "quote\"\n"),
+		Float64("f", 0.5),
+		Bool("ok", false),
+		Duration("d", 1500*time.Millisecond),
+		Time("t", tm),
+		Err(errors.New("boom")),
+		Object("user", user{1, "jim"}),
+		Any("list", []int{1, 2}),
+	)
+
+	assert.Equal(t, " | a=1 z=quote\"\n f=0.5 ok=false d=1.5s t=2017-01-02T03:04:05Z error=boom user={id=1 name=jim} list=[1 2]",
+		record.KVString("", ""))
+
+	text, err := (&JSONFormatter{}).Format(record)
+	assert.Nil(t, err)
+	data := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(text), &data))
+	assert.Equal(t, map[string]interface{}{
+		"a":     1.0,
+		"z":     "quote\"\n",
+		"f":     0.5,
+		"ok":    false,
+		"d":     "1.5s",
+		"t":     "2017-01-02T03:04:05Z",
+		"error": "boom",
+		"user":  map[string]interface{}{"id": 1.0, "name": "jim"},
+		"list":  []interface{}{1.0, 2.0},
+	}, data["_fields"])
+
+	// no fields
+	record = NewLogRecord(name, level, pathname, fun, line, "", "msg", Err(nil))
+	assert.Equal(t, "", record.KVString("", ""))
+	text, err = (&JSONFormatter{}).Format(record)
+	assert.Nil(t, err)
+	assert.NotContains(t, text, "_fields")
+}
+
+func TestAppendJSONString(t *testing.T) {
+	for _, s := range []string{"plain", "\"\\/", "\x00\x1f\t\r\n", "中文", "bad\xffutf8"} {
+		expected, _ := json.Marshal(s)
+		var actual, decoded string
+		assert.Nil(t, json.Unmarshal(appendJSONString(nil, s), &actual))
+		json.Unmarshal(expected, &decoded)
+		assert.Equal(t, decoded, actual)
+	}
+}
+
+func TestJsonFormatterAllocs(t *testing.T) {
+	formatter := &JSONFormatter{TimeEncoding: TimeEncodingRFC3339Nano}
+	record := NewLogRecord("", 0, "file/test", "func", 0, "", "msg")
+	record.TypedFields = []Field{
+		String("a", "b"), Int("c", 1), Duration("d", time.Second), Bool("e", true),
+		Time("t", time.Now()), Err(errors.New("boom")),
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		formatter.Format(record)
+	})
+	// it was 46 when fields were put in a map and encoded by json.Marshal
+	assert.True(t, allocs <= 4, "%v allocs per record", allocs)
+}
+
+func TestTimeField(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	tm := time.Date(2017, 1, 2, 3, 4, 5, 6, loc)
+	f := Time("t", tm)
+	assert.Equal(t, tm, f.Value())
+	assert.Equal(t, `"2017-01-02T03:04:05.000000006+08:00"`, string(f.appendJSON(nil)))
+
+	// out of the range of UnixNano
+	tm = time.Date(3000, 1, 2, 3, 4, 5, 0, time.UTC)
+	f = Time("t", tm)
+	assert.Equal(t, tm, f.Value())
+	assert.Equal(t, "3000-01-02T03:04:05Z", string(f.appendText(nil)))
+}
+
+func TestAppendJSONFloat(t *testing.T) {
+	for _, v := range []float64{0, 0.5, -1.25, 1e6, 123456789, 1e20, 1e21, 1e-6, 1e-7, -2.5e-10, 1.5e300} {
+		expected, _ := json.Marshal(v)
+		assert.Equal(t, string(expected), string(appendJSONFloat(nil, v)))
+	}
+	assert.Equal(t, `"NaN"`, string(appendJSONFloat(nil, math.NaN())))
+}
+
+func BenchmarkTypedFieldsJsonFormatter(b *testing.B) {
+	formatter := &JSONFormatter{}
+	record := NewLogRecord("", 0, "file/test", "func", 0, "", "msg",
+		String("a", "b"), Int("c", 1), Duration("d", time.Second), Bool("e", true))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := formatter.Format(record); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLogFieldsJSON(b *testing.B) {
+	logger := NewLogger(OptionHandlers(
+		NewStreamHandler(NewJSONFormatter(), OptionDiscardOutput()),
+	))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.LogFields(InfoLevel, "msg",
+			String("a", "b"), Int("c", 1), Duration("d", time.Second), Bool("e", true))
+	}
+}
+
+func BenchmarkLogTypedArgsJSON(b *testing.B) {
+	logger := NewLogger(OptionHandlers(
+		NewStreamHandler(NewJSONFormatter(), OptionDiscardOutput()),
+	))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("msg",
+			String("a", "b"), Int("c", 1), Duration("d", time.Second), Bool("e", true))
+	}
+}
+
+func BenchmarkMapFieldsJsonFormatter(b *testing.B) {
+	formatter := &JSONFormatter{}
+	record := NewLogRecord("", 0, "file/test", "func", 0, "", "msg",
+		Fields{"a": "b", "c": 1, "d": time.Second, "e": true})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := formatter.Format(record); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
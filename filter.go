@@ -0,0 +1,284 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/zoumo/logdog/pkg/pythonic"
+)
+
+// Filter decides whether a LogRecord should be dropped,
+// Filter returns true if the record should be dropped
+type Filter interface {
+	Filter(*LogRecord) bool
+}
+
+// Filterer is a chain of filters and a LevelMask, it is embedded in loggers
+// and handlers. A record is dropped if its level is not in LevelMask,
+// or any filter in the chain drops it.
+type Filterer struct {
+	Filters   []Filter
+	LevelMask LevelMask
+}
+
+// AddFilters adds filters to the chain
+func (f *Filterer) AddFilters(filters ...Filter) {
+	f.Filters = append(f.Filters, filters...)
+}
+
+// Filter checks if the record is out of LevelMask or
+// any filter in the chain drops it
+func (f Filterer) Filter(record *LogRecord) bool {
+	if !f.LevelMask.Contains(record.Level) {
+		return true
+	}
+	for _, filter := range f.Filters {
+		if filter.Filter(record) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadFilters returns the registered filters named
+// in the "filters" key of config
+func LoadFilters(c map[string]interface{}) ([]Filter, error) {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []Filter{}
+	for _, v := range config.MustGetArray("filters", make([]interface{}, 0)) {
+		name := fmt.Sprint(v)
+		filter := GetFilter(name)
+		if filter == nil {
+			return nil, fmt.Errorf("can not find filter: %s", name)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// LoadLevelMask returns the LevelMask of level names in the "levels"
+// key of config, e.g. ["ERROR", "FATAL"] or ["!INFO"].
+// It returns the zero mask if the key is not set
+func LoadLevelMask(c map[string]interface{}) (LevelMask, error) {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return 0, err
+	}
+
+	names := []string{}
+	for _, v := range config.MustGetArray("levels", make([]interface{}, 0)) {
+		names = append(names, fmt.Sprint(v))
+	}
+	return ParseLevelMask(names...)
+}
+
+// FilterFunc is an adapter to allow the use of ordinary functions as Filter,
+// it returns true if the record should be dropped
+type FilterFunc func(*LogRecord) bool
+
+// Filter calls f(record)
+func (f FilterFunc) Filter(record *LogRecord) bool {
+	return f(record)
+}
+
+// Not returns a Filter which drops records passed by filter
+func Not(filter Filter) Filter {
+	return FilterFunc(func(record *LogRecord) bool {
+		return !filter.Filter(record)
+	})
+}
+
+// NameFilter passes records logged by the logger named Prefix
+// or its descendants, e.g. "app.db" passes "app.db" and "app.db.pool"
+// but not "app.dbx". An empty Prefix passes all records.
+type NameFilter struct {
+	Prefix string
+}
+
+// NewNameFilter returns a NameFilter passing records of logger prefix and its descendants
+func NewNameFilter(prefix string) *NameFilter {
+	return &NameFilter{Prefix: prefix}
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (f *NameFilter) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+	f.Prefix = config.MustGetString("prefix", "")
+	return nil
+}
+
+// Filter drops records of other loggers
+func (f *NameFilter) Filter(record *LogRecord) bool {
+	if f.Prefix == "" || record.Name == f.Prefix {
+		return false
+	}
+	return !strings.HasPrefix(record.Name, f.Prefix+".")
+}
+
+// FieldFilter passes records whose field Key equals Value.
+// Values of different types are equal if they print the same,
+// so that value 42 loaded from JSON config matches int 42.
+type FieldFilter struct {
+	Key   string
+	Value interface{}
+}
+
+// NewFieldFilter returns a FieldFilter passing records whose field key equals value
+func NewFieldFilter(key string, value interface{}) *FieldFilter {
+	return &FieldFilter{Key: key, Value: value}
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (f *FieldFilter) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+	f.Key = config.MustGetString("key", "")
+	if f.Key == "" {
+		return fmt.Errorf("'key' field is required by FieldFilter")
+	}
+	f.Value = c["value"]
+	return nil
+}
+
+// Filter drops records without the field or with a different value
+func (f *FieldFilter) Filter(record *LogRecord) bool {
+	v, ok := record.GetField(f.Key)
+	if !ok {
+		return true
+	}
+	return !reflect.DeepEqual(v, f.Value) && fmt.Sprint(v) != fmt.Sprint(f.Value)
+}
+
+// MessageFilter passes records whose message matches Pattern
+type MessageFilter struct {
+	Pattern *regexp.Regexp
+}
+
+// NewMessageFilter returns a MessageFilter passing records whose message matches pattern
+func NewMessageFilter(pattern string) (*MessageFilter, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageFilter{Pattern: re}, nil
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (f *MessageFilter) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+	f.Pattern, err = regexp.Compile(config.MustGetString("pattern", ""))
+	return err
+}
+
+// Filter drops records whose message does not match
+func (f *MessageFilter) Filter(record *LogRecord) bool {
+	return !f.Pattern.MatchString(record.GetMessage())
+}
+
+// LevelFilter passes records whose level is between Min and Max inclusive,
+// and is one of Levels if Levels is not empty. Zero Max means no upper bound.
+type LevelFilter struct {
+	Min    Level
+	Max    Level
+	Levels []Level
+}
+
+// NewLevelFilter returns a LevelFilter passing records
+// whose level is between min and max inclusive
+func NewLevelFilter(min, max Level) *LevelFilter {
+	return &LevelFilter{Min: min, Max: max}
+}
+
+// NewLevelSetFilter returns a LevelFilter passing records
+// whose level is one of levels
+func NewLevelSetFilter(levels ...Level) *LevelFilter {
+	return &LevelFilter{Levels: levels}
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (f *LevelFilter) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	f.Min = GetLevel(config.MustGetString("min", "NOTHING"))
+	f.Max = GetLevel(config.MustGetString("max", "NOTHING"))
+	f.Levels = nil
+	for _, v := range config.MustGetArray("levels", make([]interface{}, 0)) {
+		name := fmt.Sprint(v)
+		level := GetLevel(name)
+		if level < 0 {
+			return fmt.Errorf("can not find level: %s", name)
+		}
+		f.Levels = append(f.Levels, level)
+	}
+	if f.Min < 0 || f.Max < 0 {
+		return fmt.Errorf("invalid level range: %s - %s",
+			config.MustGetString("min", ""), config.MustGetString("max", ""))
+	}
+	return nil
+}
+
+// Filter drops records whose level is out of range or not in the set
+func (f *LevelFilter) Filter(record *LogRecord) bool {
+	if record.Level < f.Min || (f.Max != NothingLevel && record.Level > f.Max) {
+		return true
+	}
+	if len(f.Levels) == 0 {
+		return false
+	}
+	for _, level := range f.Levels {
+		if record.Level == level {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	RegisterConstructor("NameFilter", func() ConfigLoader {
+		return NewNameFilter("")
+	})
+	RegisterConstructor("FieldFilter", func() ConfigLoader {
+		return NewFieldFilter("", nil)
+	})
+	RegisterConstructor("MessageFilter", func() ConfigLoader {
+		return &MessageFilter{}
+	})
+	RegisterConstructor("LevelFilter", func() ConfigLoader {
+		return NewLevelFilter(NothingLevel, NothingLevel)
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFilterRecord(name string, level Level, msg string, fields Fields) *LogRecord {
+	record := NewLogRecord(name, level, pathname, fun, line, msg)
+	record.Fields = fields
+	return record
+}
+
+func TestNameFilter(t *testing.T) {
+	f := NewNameFilter("app.db")
+	assert.False(t, f.Filter(newFilterRecord("app.db", InfoLevel, "", nil)))
+	assert.False(t, f.Filter(newFilterRecord("app.db.pool", InfoLevel, "", nil)))
+	assert.True(t, f.Filter(newFilterRecord("app.dbx", InfoLevel, "", nil)))
+	assert.True(t, f.Filter(newFilterRecord("app", InfoLevel, "", nil)))
+	assert.False(t, NewNameFilter("").Filter(newFilterRecord("app", InfoLevel, "", nil)))
+}
+
+func TestFieldFilter(t *testing.T) {
+	f := NewFieldFilter("user_id", 42)
+	assert.False(t, f.Filter(newFilterRecord("", InfoLevel, "", Fields{"user_id": 42})))
+	assert.False(t, f.Filter(newFilterRecord("", InfoLevel, "", Fields{"user_id": float64(42)})))
+	assert.True(t, f.Filter(newFilterRecord("", InfoLevel, "", Fields{"user_id": 7})))
+	assert.True(t, f.Filter(newFilterRecord("", InfoLevel, "", nil)))
+}
+
+func TestMessageFilter(t *testing.T) {
+	f, err := NewMessageFilter(`^GET /health`)
+	assert.Nil(t, err)
+	assert.False(t, f.Filter(newFilterRecord("", InfoLevel, "GET /health 200", nil)))
+	assert.True(t, f.Filter(newFilterRecord("", InfoLevel, "POST /login 200", nil)))
+
+	// drop health checks
+	assert.True(t, Not(f).Filter(newFilterRecord("", InfoLevel, "GET /health 200", nil)))
+
+	_, err = NewMessageFilter(`(`)
+	assert.NotNil(t, err)
+}
+
+func TestLevelFilter(t *testing.T) {
+	f := NewLevelFilter(InfoLevel, ErrorLevel)
+	assert.True(t, f.Filter(newFilterRecord("", DebugLevel, "", nil)))
+	assert.False(t, f.Filter(newFilterRecord("", InfoLevel, "", nil)))
+	assert.False(t, f.Filter(newFilterRecord("", ErrorLevel, "", nil)))
+	assert.True(t, f.Filter(newFilterRecord("", FatalLevel, "", nil)))
+
+	set := NewLevelSetFilter(DebugLevel, ErrorLevel)
+	assert.False(t, set.Filter(newFilterRecord("", DebugLevel, "", nil)))
+	assert.True(t, set.Filter(newFilterRecord("", InfoLevel, "", nil)))
+	assert.False(t, set.Filter(newFilterRecord("", ErrorLevel, "", nil)))
+}
+
+func TestFilterChain(t *testing.T) {
+	hdlr := &recordHandler{}
+	logger := NewLogger(OptionHandlers(hdlr), OptionFilters(
+		FilterFunc(func(record *LogRecord) bool {
+			return record.Fields["secret"] != nil
+		}),
+	))
+	logger.AddFilters(NewLevelFilter(InfoLevel, NothingLevel))
+	assert.Len(t, logger.Filters, 2)
+
+	logger.Debug("dropped by level")
+	logger.Info("dropped by func", Fields{"secret": "x"})
+	logger.Info("passed")
+	logger.With(Fields{"k": "v"}).Debug("filters are copied to child")
+	assert.Equal(t, []string{"passed"}, hdlr.messages)
+
+	// filters of handler
+	stream := NewStreamHandler(OptionDiscardOutput())
+	stream.AddFilters(NewNameFilter("app"))
+	assert.True(t, stream.Filter(newFilterRecord("other", InfoLevel, "", nil)))
+	assert.False(t, stream.Filter(newFilterRecord("app.db", InfoLevel, "", nil)))
+}
+
+func TestLoadJSONConfigFilters(t *testing.T) {
+	config := []byte(`{
+        "filters": {
+            "onlyApp": {
+                "class": "NameFilter",
+                "prefix": "filters"
+            },
+            "user42": {
+                "class": "FieldFilter",
+                "key": "user_id",
+                "value": 42
+            },
+            "noHealth": {
+                "class": "MessageFilter",
+                "pattern": "^(?:[^h]|h[^e])"
+            },
+            "errors": {
+                "class": "LevelFilter",
+                "min": "WARN",
+                "max": "ERROR"
+            }
+        },
+        "handlers": {
+            "filteredFile": {
+                "class": "FileHandler",
+                "filename": "/dev/null",
+                "filters": ["onlyApp", "errors"]
+            }
+        },
+        "loggers": {
+            "filters": {
+                "filters": ["user42", "noHealth"]
+            }
+        }
+    }`)
+
+	err := LoadJSONConfig(config)
+	assert.Nil(t, err)
+	assert.IsType(t, &NameFilter{}, GetFilter("onlyApp"))
+
+	hdlr := GetHandler("filteredFile").(*FileHandler)
+	assert.Len(t, hdlr.Filters, 2)
+	assert.False(t, hdlr.Filter(newFilterRecord("filters.db", WarnLevel, "", nil)))
+	assert.True(t, hdlr.Filter(newFilterRecord("filters.db", InfoLevel, "", nil)))
+	assert.True(t, hdlr.Filter(newFilterRecord("other", ErrorLevel, "", nil)))
+
+	logger := GetLogger("filters")
+	assert.Len(t, logger.Filters, 2)
+	assert.False(t, logger.Filter(newFilterRecord("filters", InfoLevel, "login", Fields{"user_id": 42})))
+	assert.True(t, logger.Filter(newFilterRecord("filters", InfoLevel, "health", Fields{"user_id": 42})))
+	assert.True(t, logger.Filter(newFilterRecord("filters", InfoLevel, "login", nil)))
+
+	err = LoadJSONConfig([]byte(`{"loggers": {"filters.unknown": {"filters": ["unknown"]}}}`))
+	assert.EqualError(t, err, "can not find filter: unknown")
+}
+
+func TestLevelMask(t *testing.T) {
+	m := NewLevelMask(DebugLevel, NoticeLevel)
+	assert.True(t, m.Contains(DebugLevel))
+	assert.True(t, m.Contains(NoticeLevel))
+	assert.False(t, m.Contains(InfoLevel))
+	assert.False(t, m.Contains(FatalLevel))
+	assert.Equal(t, "DEBUG|NOTICE", m.String())
+
+	except := ExceptLevels(InfoLevel)
+	assert.False(t, except.Contains(InfoLevel))
+	assert.True(t, except.Contains(DebugLevel))
+	assert.True(t, except.Contains(FatalLevel))
+
+	// the zero mask contains all levels
+	assert.True(t, LevelMask(0).Contains(InfoLevel))
+
+	parsed, err := ParseLevelMask("ERROR", "FATAL")
+	assert.Nil(t, err)
+	assert.Equal(t, NewLevelMask(ErrorLevel, FatalLevel), parsed)
+	parsed, err = ParseLevelMask("!INFO")
+	assert.Nil(t, err)
+	assert.Equal(t, except, parsed)
+	parsed, err = ParseLevelMask("ALL", "!DEBUG", "!INFO")
+	assert.Nil(t, err)
+	assert.Equal(t, ExceptLevels(DebugLevel, InfoLevel), parsed)
+	_, err = ParseLevelMask("VERBOSE")
+	assert.EqualError(t, err, "can not find level: VERBOSE")
+
+	hdlr := NewStreamHandler(OptionDiscardOutput(), NewLevelMask(DebugLevel, NoticeLevel))
+	assert.False(t, hdlr.Filter(newFilterRecord("", DebugLevel, "", nil)))
+	assert.True(t, hdlr.Filter(newFilterRecord("", InfoLevel, "", nil)))
+	assert.False(t, hdlr.Filter(newFilterRecord("", NoticeLevel, "", nil)))
+}
+
+func TestLoadJSONConfigLevelMask(t *testing.T) {
+	config := []byte(`{
+        "handlers": {
+            "maskErrors": {
+                "class": "FileHandler",
+                "filename": "/dev/null",
+                "levels": ["ERROR", "FATAL"]
+            },
+            "maskOthers": {
+                "class": "FileHandler",
+                "filename": "/dev/null",
+                "levels": ["!ERROR", "!FATAL"]
+            }
+        }
+    }`)
+
+	err := LoadJSONConfig(config)
+	assert.Nil(t, err)
+	errors := GetHandler("maskErrors").(*FileHandler)
+	others := GetHandler("maskOthers").(*FileHandler)
+	// every level goes to exactly one handler
+	for _, level := range []Level{DebugLevel, InfoLevel, WarnLevel, ErrorLevel, NoticeLevel, FatalLevel} {
+		record := newFilterRecord("", level, "", nil)
+		assert.NotEqual(t, errors.Filter(record), others.Filter(record), level.String())
+	}
+
+	err = LoadJSONConfig([]byte(`{"handlers": {"maskUnknown": {"class": "StreamHandler", "levels": ["VERBOSE"]}}}`))
+	assert.EqualError(t, err, "can not find level: VERBOSE")
+}
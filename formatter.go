@@ -15,12 +15,15 @@
 package logdog
 
 import (
-	"encoding/json"
 	"fmt"
 	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/zoumo/logdog/pkg/pythonic"
 	"github.com/zoumo/logdog/pkg/when"
@@ -54,6 +57,15 @@ func FormatTime(record *LogRecord, datefmt string) string {
 // formatted into a LogRecord's message attribute. Currently, the useful
 // attributes in a LogRecord are described by:
 //
+// Every attribute can be followed by a printf-style spec like python's
+// %[(name)][flags][width].[precision]typecode, e.g. %(levelname)-8s,
+// %(lineno)04d, %(message).200s. Flags are '#', '0', '+' and '-',
+// typecodes are d, i, u, o, x, X, e, E, f, F, g, G, c, s, r and a.
+// r and a quote strings like Go's %q instead of python's repr.
+// An attribute without typecode is formatted as %s, except that
+// %(levelname) is padded to 6 characters as %(levelname)6s like it
+// always was, use %(levelname)s for the bare name.
+//
 // %(name)            Name of the logger (logging channel)
 // %(levelno)         Numeric logging level for the message (DEBUG, INFO,
 //                    WARNING, ERROR, CRITICAL)
@@ -62,22 +74,46 @@ func FormatTime(record *LogRecord, datefmt string) string {
 // %(pathname)        Full pathname of the source file where the logging
 //                    call was issued (if available) or maybe ??
 // %(filename)        Filename portion of pathname
+// %(module)          Module (name portion of filename)
+// %(package)         Import path of the package of caller
 // %(lineno)          Source line number where the logging call was issued
 //                    (if available)
 // %(funcname)        Function name of caller or maybe ??
 // %(time)            Textual time when the LogRecord was created
+// %(created)         Time when the LogRecord was created in seconds
+//                    since the epoch
+// %(msecs)           Millisecond portion of the creation time
+// %(relativeCreated) Time in milliseconds when the LogRecord was created,
+//                    relative to the time the program starts
+// %(process)         Process ID
+// %(processName)     Process name
+// %(hostname)        Host name
+// %(goroutine)       Goroutine ID (if runtime caller is enabled)
+// %(thread)          Alias of %(goroutine)
 // %(message)         The result of record.getMessage(), computed just as
 //                    the record is emitted
+// %(error)           The message of the error in args, its chain is
+//                    appended like "msg (caused by: msg1; msg2)"
+// %(stack)           The stack trace captured, starts with a newline,
+//                    empty if it is not captured
 // %(color)           Print color
 // %(endColor)        Reset color
 type TextFormatter struct {
-	fieldSequence []string
-	fmtTeplate    string
-	Fmt           string
-	DateFmt       string
-	EnableColors  bool
-	mu            sync.Mutex
+	Fmt          string
+	DateFmt      string
+	EnableColors bool
 	ConfigLoader
+
+	// compiled holds *compiledText, it is read without lock
+	// and mu is held only when Fmt is compiled again
+	compiled atomic.Value
+	mu       sync.Mutex
+}
+
+// compiledText is Fmt of TextFormatter and its segments
+type compiledText struct {
+	fmt      string
+	segments []textSegment
 }
 
 const (
@@ -96,9 +132,9 @@ const (
 
 var (
 	// LogRecordFieldRegexp is the field regexp
-	// for example, I will replace %(name) of real record name
-	// TODO support %[(name)][flags][width].[precision]typecode
-	LogRecordFieldRegexp = regexp.MustCompile(`\%\(\w+\)`)
+	// for example, I will replace %(name) of real record name,
+	// it matches %[(name)][flags][width].[precision]typecode
+	LogRecordFieldRegexp = regexp.MustCompile(`%\((\w+)\)([#0+\-]*)(\d*)(?:\.(\d+))?([diouxXeEfFgGcsra]?)`)
 	// DefaultFormatter is the default formatter of TextFormatter without color
 	DefaultFormatter = &TextFormatter{
 		Fmt:     DefaultFmtTemplate,
@@ -164,34 +200,35 @@ func (tf *TextFormatter) LoadConfig(c map[string]interface{}) error {
 	tf.DateFmt = config.MustGetString("datefmt", DefaultDateFmtTemplate)
 	tf.EnableColors = config.MustGetBool("enableColors", false)
 
-	return nil
+	_, err = tf.parse()
+	return err
 
 }
 
-// parse shoule run only once
-func (tf *TextFormatter) parse() {
-	if tf.fmtTeplate != "" && len(tf.fieldSequence) > 0 {
-		return
+// parse compiles Fmt once, it compiles again if Fmt is changed
+func (tf *TextFormatter) parse() ([]textSegment, error) {
+	if c, ok := tf.compiled.Load().(*compiledText); ok && c.fmt == tf.Fmt {
+		return c.segments, nil
 	}
 
 	tf.mu.Lock()
 	defer tf.mu.Unlock()
+
 	if tf.Fmt == "" {
+		// Don't open color printing by default
+		tf.EnableColors = false
 		tf.Fmt = DefaultFmtTemplate
 	}
+	if c, ok := tf.compiled.Load().(*compiledText); ok && c.fmt == tf.Fmt {
+		return c.segments, nil
+	}
 
-	// append fields to Fmt no matter what it is
-	tf.Fmt += "%(fields)"
-
-	// replace %(field) with %s && add field name to sequence
-	// e.g. covert %(name) %(message) to %s %s
-	tf.fmtTeplate = LogRecordFieldRegexp.ReplaceAllStringFunc(tf.Fmt, func(match string) string {
-		// match : %(field)
-		field := match[2 : len(match)-1]
-		tf.fieldSequence = append(tf.fieldSequence, field)
-		return "%s"
-	})
-
+	segments, err := compileTextFmt(tf.Fmt)
+	if err != nil {
+		return nil, err
+	}
+	tf.compiled.Store(&compiledText{fmt: tf.Fmt, segments: segments})
+	return segments, nil
 }
 
 func (tf *TextFormatter) getColor(record *LogRecord) (string, string) {
@@ -208,56 +245,267 @@ func (tf *TextFormatter) getColor(record *LogRecord) (string, string) {
 // ReplaceAllStringFunc    8420 ns/op
 // field sequence          5046 ns/op
 func (tf *TextFormatter) Format(record *LogRecord) (string, error) {
-
-	if tf.Fmt == "" {
-		// Don't open color printing by default
-		tf.EnableColors = false
-		tf.Fmt = DefaultFmtTemplate
+	segments, err := tf.parse()
+	if err != nil {
+		return "", err
 	}
 
-	tf.parse()
-
 	color, endColor := tf.getColor(record)
 
-	sequnce := make([]interface{}, 0, 20)
+	b := make(buffer, 0, 256)
+	for _, seg := range segments {
+		if seg.field == "" {
+			b = append(b, seg.literal...)
+			continue
+		}
 
-	for _, field := range tf.fieldSequence {
-		switch field {
-		case "name":
-			sequnce = append(sequnce, record.Name)
+		var value interface{}
+		switch seg.field {
 		case "time":
-			sequnce = append(sequnce, FormatTime(record, tf.DateFmt))
-		case "levelno":
-			sequnce = append(sequnce, fmt.Sprintf("%d", record.Level))
-		case "levelname":
-			sequnce = append(sequnce, fmt.Sprintf("%6s", record.LevelName))
-		case "pathname":
-			sequnce = append(sequnce, record.PathName)
-		case "filename":
-			sequnce = append(sequnce, record.FileName)
-		case "funcname":
-			sequnce = append(sequnce, record.ShortFuncName)
-		case "lineno":
-			sequnce = append(sequnce, fmt.Sprintf("%d", record.Line))
-		case "message":
-			sequnce = append(sequnce, record.GetMessage())
+			value = FormatTime(record, tf.DateFmt)
 		case "color":
-			sequnce = append(sequnce, color)
+			value = color
 		case "endColor":
-			sequnce = append(sequnce, endColor)
+			value = endColor
+		case "error":
+			value = formatError(record.Error)
+		case "stack":
+			stack := record.Stack
+			if stack != "" {
+				stack = "\n" + stack
+			}
+			value = stack
 		case "fields":
-			sequnce = append(sequnce, record.Fields.ToKVString(color, endColor))
+			value = record.KVString(color, endColor)
+		default:
+			value, _ = record.Attribute(seg.field)
+		}
+		b = seg.append(b, value)
+	}
+	return string(b), nil
+}
+
+// textFields are the attributes only supported by TextFormatter,
+// all attributes of LogRecord.Attribute are supported too
+var textFields = map[string]attrKind{
+	"time":     stringAttr,
+	"color":    stringAttr,
+	"endColor": stringAttr,
+	"error":    stringAttr,
+	"stack":    stringAttr,
+	"fields":   stringAttr,
+}
+
+// textSegment is a literal text or an attribute with its
+// format verb of package fmt in a compiled Fmt
+type textSegment struct {
+	literal string
+	field   string
+	verb    string
+	// convert converts the value before it is formatted by verb
+	convert func(interface{}) interface{}
+}
+
+// append appends value formatted by the segment to b
+func (seg textSegment) append(b buffer, value interface{}) buffer {
+	if seg.convert != nil {
+		value = seg.convert(value)
+	}
+	if s, ok := value.(string); ok && seg.verb == "%s" {
+		return append(b, s...)
+	}
+	fmt.Fprintf(&b, seg.verb, value)
+	return b
+}
+
+// compileTextFmt compiles format to segments, %(fields) is appended
+// if it is not in format
+func compileTextFmt(format string) ([]textSegment, error) {
+	segments := []textSegment{}
+	literal := []byte{}
+	for i := 0; i < len(format); {
+		c := format[i]
+		if c != '%' {
+			literal = append(literal, c)
+			i++
+			continue
+		}
+		if strings.HasPrefix(format[i:], "%%") {
+			literal = append(literal, '%')
+			i += 2
+			continue
+		}
+
+		m := LogRecordFieldRegexp.FindStringSubmatchIndex(format[i:])
+		if m == nil || m[0] != 0 {
+			return nil, fmt.Errorf("invalid format %q: bad spec %q at %d, it should be like %%(name)s, use %%%% for %%", format, format[i:], i)
+		}
+		typecode := format[i+m[10] : i+m[11]]
+		spec, end := format[i+m[4]:i+m[10]], m[1]
+		if typecode == "" {
+			// flags, width and precision without typecode are literal text
+			spec, end = "", m[4]
+			if format[i+m[2]:i+m[3]] == "levelname" {
+				// keep the padding of levelname before specs are supported
+				spec = "6"
+			}
+		}
+		seg, err := compileTextSpec(format, format[i+m[2]:i+m[3]], spec, typecode)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(literal) > 0 {
+			segments = append(segments, textSegment{literal: string(literal)})
+			literal = literal[:0]
+		}
+		segments = append(segments, seg)
+		i += end
+	}
+	if len(literal) > 0 {
+		segments = append(segments, textSegment{literal: string(literal)})
+	}
+
+	// append fields to Fmt no matter what it is
+	if !strings.Contains(format, "%(fields)") {
+		segments = append(segments, textSegment{field: "fields", verb: "%s"})
+	}
+	return segments, nil
+}
+
+// compileTextSpec compiles the spec of field, spec is made up of
+// flags, width and precision like -8 or 04 or .200
+func compileTextSpec(format, field, spec, typecode string) (textSegment, error) {
+	kind, ok := textFields[field]
+	if !ok {
+		kind, ok = recordAttributes[field]
+	}
+	if !ok {
+		return textSegment{}, fmt.Errorf("invalid format %q: unknown field %%(%s)", format, field)
+	}
+
+	seg := textSegment{field: field}
+	verb := typecode
+	switch typecode {
+	case "", "s":
+		verb = "s"
+		if kind != stringAttr {
+			seg.convert = toText
+		}
+	case "r", "a":
+		verb = "q"
+		if kind != stringAttr {
+			verb, seg.convert = "s", toText
+		}
+	case "d", "i", "u", "o", "x", "X", "c":
+		if kind == stringAttr {
+			return textSegment{}, fmt.Errorf("invalid format %q: %%(%s) is not a number, can not be formatted by %%%s", format, field, typecode)
+		}
+		if typecode == "i" || typecode == "u" {
+			verb = "d"
+		}
+		if kind == floatAttr {
+			seg.convert = toInt
+		}
+	default:
+		// e, E, f, F, g, G
+		if kind == stringAttr {
+			return textSegment{}, fmt.Errorf("invalid format %q: %%(%s) is not a number, can not be formatted by %%%s", format, field, typecode)
+		}
+		if kind == intAttr {
+			seg.convert = toFloat
 		}
 	}
-	return fmt.Sprintf(tf.fmtTeplate, sequnce...), nil
+	seg.verb = "%" + spec + verb
+	return seg, nil
+}
+
+func toText(v interface{}) interface{} {
+	return fmt.Sprint(v)
 }
 
+func toInt(v interface{}) interface{} {
+	return int64(v.(float64))
+}
+
+func toFloat(v interface{}) interface{} {
+	return float64(v.(int))
+}
+
+// TimeEncoding decides how JSONFormatter encodes time
+type TimeEncoding string
+
+const (
+	// TimeEncodingStrftime encodes time by Datefmt
+	TimeEncodingStrftime TimeEncoding = "strftime"
+	// TimeEncodingRFC3339Nano encodes time as RFC3339 with nanoseconds
+	TimeEncodingRFC3339Nano TimeEncoding = "rfc3339nano"
+	// TimeEncodingEpoch encodes time as seconds since the epoch in float
+	TimeEncodingEpoch TimeEncoding = "epoch"
+	// TimeEncodingEpochMillis encodes time as milliseconds since the epoch
+	TimeEncodingEpochMillis TimeEncoding = "epochMillis"
+)
+
+// LevelEncoding decides how JSONFormatter encodes level
+type LevelEncoding string
+
+const (
+	// LevelEncodingName encodes level as its name, e.g. "INFO"
+	LevelEncodingName LevelEncoding = "name"
+	// LevelEncodingNumber encodes level as its number, e.g. 2
+	LevelEncodingNumber LevelEncoding = "number"
+	// LevelEncodingBoth encodes level as its name in LevelKey and
+	// its number in LevelNoKey
+	LevelEncodingBoth LevelEncoding = "both"
+)
+
 // JSONFormatter can convert LogRecord to json text
+//
+// Keys of time, level, levelno, message, file, line, fields and error
+// are set to their default names if they are empty, "-" omits them.
+// Keys of name, func, pathname and pid are omitted if they are empty.
 type JSONFormatter struct {
 	Datefmt string
+	// TimeEncoding is TimeEncodingStrftime by default
+	TimeEncoding TimeEncoding
+	// LevelEncoding is LevelEncodingName by default
+	LevelEncoding LevelEncoding
+
+	TimeKey    string
+	LevelKey   string
+	LevelNoKey string
+	MessageKey string
+	FileKey    string
+	LineKey    string
+	FieldsKey  string
+	ErrorKey   string
+	NameKey    string
+	FuncKey    string
+	PathKey    string
+	PIDKey     string
+
+	// FlattenFields puts fields in the top level instead of under
+	// FieldsKey, fields colliding with other keys are prefixed
+	// with FieldsKey and a dot, e.g. _fields.level
+	FlattenFields bool
+	// Attributes are extra attributes of LogRecord written
+	// with their names as keys, e.g. process, goroutine, see
+	// LogRecord.Attribute for all attributes
+	Attributes []string
 	ConfigLoader
 }
 
+const (
+	defaultTimeKey    = "time"
+	defaultLevelKey   = "level"
+	defaultLevelNoKey = "levelno"
+	defaultMessageKey = "message"
+	defaultFileKey    = "file"
+	defaultLineKey    = "line"
+	defaultFieldsKey  = "_fields"
+	defaultErrorKey   = "error"
+)
+
 // NewJSONFormatter returns a JSONFormatter with default config
 func NewJSONFormatter() *JSONFormatter {
 	return &JSONFormatter{
@@ -274,33 +522,301 @@ func (jf *JSONFormatter) LoadConfig(c map[string]interface{}) error {
 	}
 
 	jf.Datefmt = config.MustGetString("datefmt", DefaultDateFmtTemplate)
+
+	jf.TimeEncoding = TimeEncoding(config.MustGetString("timeEncoding", string(TimeEncodingStrftime)))
+	switch jf.TimeEncoding {
+	case TimeEncodingStrftime, TimeEncodingRFC3339Nano, TimeEncodingEpoch, TimeEncodingEpochMillis:
+	default:
+		return fmt.Errorf("unknown time encoding: %s", jf.TimeEncoding)
+	}
+	jf.LevelEncoding = LevelEncoding(config.MustGetString("levelEncoding", string(LevelEncodingName)))
+	switch jf.LevelEncoding {
+	case LevelEncodingName, LevelEncodingNumber, LevelEncodingBoth:
+	default:
+		return fmt.Errorf("unknown level encoding: %s", jf.LevelEncoding)
+	}
+
+	jf.TimeKey = config.MustGetString("timeKey", "")
+	jf.LevelKey = config.MustGetString("levelKey", "")
+	jf.LevelNoKey = config.MustGetString("levelnoKey", "")
+	jf.MessageKey = config.MustGetString("messageKey", "")
+	jf.FileKey = config.MustGetString("fileKey", "")
+	jf.LineKey = config.MustGetString("lineKey", "")
+	jf.FieldsKey = config.MustGetString("fieldsKey", "")
+	jf.ErrorKey = config.MustGetString("errorKey", "")
+	jf.NameKey = config.MustGetString("nameKey", "")
+	jf.FuncKey = config.MustGetString("funcKey", "")
+	jf.PathKey = config.MustGetString("pathKey", "")
+	jf.PIDKey = config.MustGetString("pidKey", "")
+	jf.FlattenFields = config.MustGetBool("flattenFields", false)
+
+	jf.Attributes = nil
+	for _, attr := range config.MustGetArray("attributes", []interface{}{}) {
+		name := fmt.Sprint(attr)
+		if _, ok := recordAttributes[name]; !ok {
+			return fmt.Errorf("unknown record attribute: %s", name)
+		}
+		jf.Attributes = append(jf.Attributes, name)
+	}
 	return nil
 }
 
+// jsonKey returns the default key if key is empty, "" if it is "-"
+func jsonKey(key, defaultKey string) string {
+	switch key {
+	case "":
+		return defaultKey
+	case "-":
+		return ""
+	}
+	return key
+}
+
 // Format converts the specified record to json string.
+// Members are sorted by key and values are appended to a buffer
+// directly, there is no intermediate map or json.Marshal.
 func (jf *JSONFormatter) Format(record *LogRecord) (string, error) {
-	fields := make(Fields, len(record.Fields)+4)
-	for k, v := range record.Fields {
-		fields[k] = v
+	obj := jsonObjectPool.Get().(*jsonObject)
+	defer obj.free()
+
+	jf.appendTime(obj, jsonKey(jf.TimeKey, defaultTimeKey), record)
+	obj.addString(jsonKey(jf.MessageKey, defaultMessageKey), record.GetMessage())
+	obj.addString(jsonKey(jf.FileKey, defaultFileKey), record.FileName)
+	obj.addInt(jsonKey(jf.LineKey, defaultLineKey), int64(record.Line))
+	switch jf.LevelEncoding {
+	case LevelEncodingNumber:
+		obj.addInt(jsonKey(jf.LevelKey, defaultLevelKey), int64(record.Level))
+	case LevelEncodingBoth:
+		obj.addString(jsonKey(jf.LevelKey, defaultLevelKey), record.LevelName)
+		obj.addInt(jsonKey(jf.LevelNoKey, defaultLevelNoKey), int64(record.Level))
+	default:
+		obj.addString(jsonKey(jf.LevelKey, defaultLevelKey), record.LevelName)
+	}
+	obj.addString(jf.NameKey, record.Name)
+	obj.addString(jf.FuncKey, record.FuncName)
+	obj.addString(jf.PathKey, record.PathName)
+	obj.addInt(jf.PIDKey, int64(record.Process))
+	for _, attr := range jf.Attributes {
+		if v, ok := record.Attribute(attr); ok {
+			obj.addField(attr, Any(attr, v))
+		}
 	}
-	// jf.formatFields(fields)
-	data := make(map[string]interface{})
+	if key := jsonKey(jf.ErrorKey, defaultErrorKey); key != "" && (record.Error != nil || record.Stack != "") {
+		start := len(obj.buf)
+		obj.buf = appendJSONError(obj.buf, record)
+		obj.add(key, start)
+	}
+
+	fieldsKey := jsonKey(jf.FieldsKey, defaultFieldsKey)
+	if jf.FlattenFields {
+		prefix := fieldsKey
+		if prefix == "" {
+			prefix = defaultFieldsKey
+		}
+		// keys added above are reserved, fields can not override them
+		reserved := len(obj.members)
+		eachField(record.Fields, record.TypedFields, func(f Field) {
+			if f.Type == SkipType {
+				return
+			}
+			key := f.Key
+			if obj.has(key, reserved) {
+				key = prefix + "." + key
+			}
+			obj.addField(key, f)
+		})
+	} else if fieldsKey != "" && (len(record.Fields) > 0 || len(record.TypedFields) > 0) {
+		start := len(obj.buf)
+		enc := fieldEncoder{buf: append(obj.buf, '{'), json: true}
+		eachField(record.Fields, record.TypedFields, enc.AddField)
+		obj.buf = append(enc.buf, '}')
+		if enc.count == 0 {
+			obj.buf = obj.buf[:start]
+		} else {
+			obj.add(fieldsKey, start)
+		}
+	}
+
+	return string(obj.appendTo(obj.out[:0])), nil
+}
+
+// appendTime adds the creation time of record encoded by TimeEncoding
+func (jf *JSONFormatter) appendTime(obj *jsonObject, key string, record *LogRecord) {
+	if key == "" {
+		return
+	}
+	start := len(obj.buf)
+	switch jf.TimeEncoding {
+	case TimeEncodingRFC3339Nano:
+		obj.buf = append(obj.buf, '"')
+		obj.buf = record.Time.AppendFormat(obj.buf, time.RFC3339Nano)
+		obj.buf = append(obj.buf, '"')
+	case TimeEncodingEpoch:
+		obj.buf = appendJSONFloat(obj.buf, record.Created())
+	case TimeEncodingEpochMillis:
+		obj.buf = strconv.AppendInt(obj.buf, record.Time.UnixNano()/int64(time.Millisecond), 10)
+	default:
+		obj.buf = appendJSONString(obj.buf, FormatTime(record, jf.Datefmt))
+	}
+	obj.add(key, start)
+}
 
-	data["time"] = FormatTime(record, jf.Datefmt)
-	data["message"] = record.GetMessage()
-	data["file"] = record.FileName
-	data["line"] = record.Line
-	data["level"] = record.LevelName
-	if len(fields) > 0 {
-		data["_fields"] = fields
+// formatError formats err and its chain like "msg (caused by: msg1; msg2)"
+func formatError(err error) string {
+	if err == nil {
+		return ""
 	}
+	msg := err.Error()
+	chain := ErrorChain(err)
+	if len(chain) == 0 {
+		return msg
+	}
+	msg += " (caused by: "
+	for i, e := range chain {
+		if i > 0 {
+			msg += "; "
+		}
+		msg += e.Error()
+	}
+	return msg + ")"
+}
 
-	jsonBytes, err := json.Marshal(data)
+// appendJSONError appends the error and stack of record as a JSON
+// object with keys chain, message, stack and type to b
+func appendJSONError(b []byte, record *LogRecord) []byte {
+	b = append(b, '{')
+	err := record.Error
+	if err != nil {
+		if chain := ErrorChain(err); len(chain) > 0 {
+			b = append(b, `"chain":[`...)
+			for i, cause := range chain {
+				if i > 0 {
+					b = append(b, ',')
+				}
+				b = append(b, `{"message":`...)
+				b = appendJSONString(b, cause.Error())
+				b = append(b, `,"type":`...)
+				b = appendJSONString(b, errorType(cause))
+				b = append(b, '}')
+			}
+			b = append(b, "],"...)
+		}
+		b = append(b, `"message":`...)
+		b = appendJSONString(b, err.Error())
+	}
+	if record.Stack != "" {
+		if err != nil {
+			b = append(b, ',')
+		}
+		b = append(b, `"stack":`...)
+		b = appendJSONString(b, record.Stack)
+	}
 	if err != nil {
-		return "", fmt.Errorf("Marashal fields to Json failed, [%v]", err)
+		b = append(b, `,"type":`...)
+		b = appendJSONString(b, errorType(err))
+	}
+	return append(b, '}')
+}
+
+// jsonObject builds a JSON object whose members are sorted by key
+// like json.Marshal does for maps. Values are appended to buf and
+// members point to them, a member added again replaces the old one.
+type jsonObject struct {
+	buf     []byte
+	out     []byte
+	members []jsonMember
+}
+
+type jsonMember struct {
+	key        string
+	start, end int
+}
+
+var jsonObjectPool = sync.Pool{
+	New: func() interface{} {
+		return &jsonObject{
+			buf:     make([]byte, 0, 512),
+			out:     make([]byte, 0, 512),
+			members: make([]jsonMember, 0, 16),
+		}
+	},
+}
+
+func (obj *jsonObject) free() {
+	obj.buf = obj.buf[:0]
+	obj.out = obj.out[:0]
+	obj.members = obj.members[:0]
+	jsonObjectPool.Put(obj)
+}
+
+// add adds the value in buf[start:] with key, empty key is omitted
+func (obj *jsonObject) add(key string, start int) {
+	if key == "" {
+		obj.buf = obj.buf[:start]
+		return
+	}
+	for i := range obj.members {
+		if obj.members[i].key == key {
+			obj.members[i].start, obj.members[i].end = start, len(obj.buf)
+			return
+		}
 	}
+	obj.members = append(obj.members, jsonMember{key: key, start: start, end: len(obj.buf)})
+}
+
+// has reports whether key is one of the first n members
+func (obj *jsonObject) has(key string, n int) bool {
+	for _, m := range obj.members[:n] {
+		if m.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (obj *jsonObject) addString(key, value string) {
+	if key != "" {
+		start := len(obj.buf)
+		obj.buf = appendJSONString(obj.buf, value)
+		obj.add(key, start)
+	}
+}
+
+func (obj *jsonObject) addInt(key string, value int64) {
+	if key != "" {
+		start := len(obj.buf)
+		obj.buf = strconv.AppendInt(obj.buf, value, 10)
+		obj.add(key, start)
+	}
+}
+
+func (obj *jsonObject) addField(key string, f Field) {
+	if key != "" {
+		start := len(obj.buf)
+		obj.buf = f.appendJSON(obj.buf)
+		obj.add(key, start)
+	}
+}
 
-	return string(jsonBytes), nil
+// appendTo appends the object with members sorted by key to b
+func (obj *jsonObject) appendTo(b []byte) []byte {
+	members := obj.members
+	// insertion sort, there are only a few members
+	for i := 1; i < len(members); i++ {
+		for j := i; j > 0 && members[j].key < members[j-1].key; j-- {
+			members[j], members[j-1] = members[j-1], members[j]
+		}
+	}
+	b = append(b, '{')
+	for i, m := range members {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, m.key)
+		b = append(b, ':')
+		b = append(b, obj.buf[m.start:m.end]...)
+	}
+	return append(b, '}')
 }
 
 func init() {
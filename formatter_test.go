@@ -15,7 +15,10 @@
 package logdog
 
 import (
+	"encoding/json"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -80,6 +83,64 @@ func TestTextFormatterLoadConfig(t *testing.T) {
 	assert.True(t, formatter.EnableColors)
 }
 
+func TestTextFormatterSpec(t *testing.T) {
+	record := NewLogRecord("app", InfoLevel, "/path/file.go", "func", 7, "100%% done")
+	record.Time = time.Date(2017, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	for _, c := range []struct {
+		fmt      string
+		expected string
+	}{
+		{"%(levelname)", "  INFO"},
+		{"%(levelname)s", "INFO"},
+		{"[%(levelname)-8s]", "[INFO    ]"},
+		{"%(levelname)6s|%(lineno)04d", "  INFO|0007"},
+		{"%(message).4s", "100%"},
+		{"%(msecs)03d %(levelno)x %(lineno)#o", "006 2 07"},
+		{"%(created).1f %(lineno).2f", "1483326245.0 7.00"},
+		{"%(name)r %(lineno)s %(lineno)5s", `"app" 7     7`},
+		{"%(time)-%(name): %(filename)", "2017-01-02 03:04:05-app: file.go"},
+		{"%%(name) 100%%", "%(name) 100%"},
+		{"%(message) %(fields)", "100% done "},
+		{"%(module).%(funcname) %(package) %(thread)", "file.func func 0"},
+	} {
+		text, err := (&TextFormatter{Fmt: c.fmt}).Format(record)
+		assert.Nil(t, err, c.fmt)
+		assert.Equal(t, c.expected, text, c.fmt)
+	}
+
+	for _, f := range []string{"%(unknown)s", "%(name)d", "%(message)f", "50% %(name)", "%(name"} {
+		_, err := (&TextFormatter{Fmt: f}).Format(record)
+		assert.NotNil(t, err, f)
+		assert.NotNil(t, NewTextFormatter().LoadConfig(Config{"fmt": f}), f)
+	}
+
+	// compile again if Fmt is changed
+	formatter := &TextFormatter{Fmt: "%(name)"}
+	text, _ := formatter.Format(record)
+	assert.Equal(t, "app", text)
+	formatter.Fmt = "%(lineno)"
+	text, _ = formatter.Format(record)
+	assert.Equal(t, "7", text)
+}
+
+func TestTextFormatterConcurrent(t *testing.T) {
+	record := NewLogRecord("app", InfoLevel, "/path/file.go", "func", 7, "msg")
+	formatter := &TextFormatter{Fmt: "%(name) %(lineno) %(message)"}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				text, err := formatter.Format(record)
+				assert.Nil(t, err)
+				assert.Equal(t, "app 7 msg", text)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func TestJsonFormatterLoadConfig(t *testing.T) {
 	formatter := NewJSONFormatter()
 	formatter.LoadConfig(Config{
@@ -88,6 +149,94 @@ func TestJsonFormatterLoadConfig(t *testing.T) {
 	assert.Equal(t, formatter.Datefmt, "test")
 }
 
+func TestJsonFormatterAttributes(t *testing.T) {
+	formatter := NewJSONFormatter()
+	assert.NotNil(t, formatter.LoadConfig(Config{"attributes": []interface{}{"unknown"}}))
+	assert.Nil(t, formatter.LoadConfig(Config{"attributes": []interface{}{"process", "hostname", "relativeCreated"}}))
+
+	record := NewLogRecord("app", InfoLevel, "/path/file.go", "func", 7, "msg")
+	text, err := formatter.Format(record)
+	assert.Nil(t, err)
+	data := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(text), &data))
+	assert.Equal(t, float64(record.Process), data["process"])
+	assert.Equal(t, record.Hostname, data["hostname"])
+	assert.Contains(t, data, "relativeCreated")
+	assert.NotContains(t, data, "goroutine")
+}
+
+func TestJsonFormatterNestedFields(t *testing.T) {
+	record := NewLogRecord("app", InfoLevel, "/path/file.go", "main.main", 7, "msg",
+		Fields{"nested": Fields{"a": 1}, "m": map[string]interface{}{"b": "c"}})
+	text, err := NewJSONFormatter().Format(record)
+	assert.Nil(t, err)
+	assert.Contains(t, text, `"_fields":{"m":{"b":"c"},"nested":{"a":1}}`)
+}
+
+func TestJsonFormatterSchema(t *testing.T) {
+	record := NewLogRecord("app", InfoLevel, "/path/file.go", "main.main", 7, "msg",
+		Fields{"msg": "field", "a": 1}, String("b", "c"))
+	record.Time = time.Date(2017, 1, 2, 3, 4, 5, 6000000, time.UTC)
+
+	format := func(config Config) map[string]interface{} {
+		formatter := NewJSONFormatter()
+		assert.Nil(t, formatter.LoadConfig(config))
+		text, err := formatter.Format(record)
+		assert.Nil(t, err)
+		data := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(text), &data))
+		return data
+	}
+
+	// default schema
+	assert.Equal(t, map[string]interface{}{
+		"time":    "2017-01-02 03:04:05",
+		"level":   "INFO",
+		"message": "msg",
+		"file":    "file.go",
+		"line":    7.0,
+		"_fields": map[string]interface{}{"a": 1.0, "msg": "field", "b": "c"},
+	}, format(Config{}))
+
+	assert.Equal(t, map[string]interface{}{
+		"@timestamp":   1483326245006.0,
+		"severity":     "INFO",
+		"severity_num": 2.0,
+		"msg":          "msg",
+		"logger":       "app",
+		"func":         "main.main",
+		"path":         "/path/file.go",
+		"pid":          float64(record.Process),
+		"a":            1.0,
+		"b":            "c",
+		"data.msg":     "field",
+	}, format(Config{
+		"timeKey":       "@timestamp",
+		"timeEncoding":  "epochMillis",
+		"levelKey":      "severity",
+		"levelnoKey":    "severity_num",
+		"levelEncoding": "both",
+		"messageKey":    "msg",
+		"fileKey":       "-",
+		"lineKey":       "-",
+		"fieldsKey":     "data",
+		"nameKey":       "logger",
+		"funcKey":       "func",
+		"pathKey":       "path",
+		"pidKey":        "pid",
+		"flattenFields": true,
+	}))
+
+	data := format(Config{"timeEncoding": "rfc3339nano", "levelEncoding": "number"})
+	assert.Equal(t, "2017-01-02T03:04:05.006Z", data["time"])
+	assert.Equal(t, 2.0, data["level"])
+	data = format(Config{"timeEncoding": "epoch"})
+	assert.Equal(t, 1483326245.006, data["time"])
+
+	assert.NotNil(t, NewJSONFormatter().LoadConfig(Config{"timeEncoding": "unknown"}))
+	assert.NotNil(t, NewJSONFormatter().LoadConfig(Config{"levelEncoding": "unknown"}))
+}
+
 func TestFormatterInterface(t *testing.T) {
 	assert.Implements(t, (*Formatter)(nil), NewTextFormatter())
 	assert.Implements(t, (*ConfigLoader)(nil), NewTextFormatter())
@@ -126,6 +275,19 @@ func BenchmarkLargeColoredTextFormatter(b *testing.B) {
 	do(b, &TextFormatter{EnableColors: true}, largeFields)
 }
 
+func BenchmarkParallelTextFormatter(b *testing.B) {
+	formatter := &TextFormatter{}
+	record := NewLogRecord("", 0, "file/test", "func", 0, "", smallFields)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := formatter.Format(record); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 func BenchmarkSmallJsonFormatter(b *testing.B) {
 	do(b, &JSONFormatter{}, smallFields)
 }
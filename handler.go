@@ -74,6 +74,14 @@ type Handler interface {
 	Close() error
 }
 
+// LevelEnabler is implemented by handlers which can tell whether they
+// take records at a level before the record is created. Loggers use it
+// to skip the work of disabled logging calls, handlers not implementing it
+// are assumed to take all levels.
+type LevelEnabler interface {
+	Enabled(Level) bool
+}
+
 // NullHandler is an example handler doing nothing
 type NullHandler struct {
 	Name string
@@ -95,6 +103,11 @@ func (hdlr *NullHandler) Filter(*LogRecord) bool {
 	return true
 }
 
+// Enabled returns false, NullHandler takes nothing
+func (hdlr *NullHandler) Enabled(Level) bool {
+	return false
+}
+
 // Emit log record to output - e.g. stderr or file
 func (hdlr *NullHandler) Emit(*LogRecord) {
 	// do nothing
@@ -119,7 +132,8 @@ type StreamHandler struct {
 	Level     Level
 	Formatter Formatter
 	Output    flushWriter
-	mu        sync.Mutex
+	Filterer
+	mu sync.Mutex
 }
 
 // NewStreamHandler returns a new StreamHandler fully initialized
@@ -163,6 +177,15 @@ func (hdlr *StreamHandler) LoadConfig(c map[string]interface{}) error {
 	}
 	hdlr.Formatter = formatter
 
+	filters, err := LoadFilters(c)
+	if err != nil {
+		return err
+	}
+	hdlr.AddFilters(filters...)
+	if hdlr.LevelMask, err = LoadLevelMask(c); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -187,9 +210,14 @@ func (hdlr *StreamHandler) Emit(record *LogRecord) {
 	fmt.Fprintln(hdlr.Output, msg)
 }
 
+// Enabled checks if handler takes records at level
+func (hdlr *StreamHandler) Enabled(level Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level)
+}
+
 // Filter checks if handler should filter the specified record
 func (hdlr *StreamHandler) Filter(record *LogRecord) bool {
-	return record.Level < hdlr.Level
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
 }
 
 // Flush flushes the file system's in-memory copy to disk
@@ -211,7 +239,8 @@ type FileHandler struct {
 	Formatter Formatter
 	Output    flushWriteCloser
 	Path      string
-	mu        sync.Mutex
+	Filterer
+	mu sync.Mutex
 }
 
 // NewFileHandler returns a new FileHandler fully initialized
@@ -262,6 +291,16 @@ func (hdlr *FileHandler) LoadConfig(c map[string]interface{}) error {
 	}
 	hdlr.Formatter = formatter
 
+	// get filters
+	filters, err := LoadFilters(c)
+	if err != nil {
+		return err
+	}
+	hdlr.AddFilters(filters...)
+	if hdlr.LevelMask, err = LoadLevelMask(c); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -304,9 +343,14 @@ func (hdlr *FileHandler) Emit(record *LogRecord) {
 	fmt.Fprintln(hdlr.Output, msg)
 }
 
+// Enabled checks if handler takes records at level
+func (hdlr *FileHandler) Enabled(level Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level)
+}
+
 // Filter checks if handler should filter the specified record
 func (hdlr *FileHandler) Filter(record *LogRecord) bool {
-	return record.Level < hdlr.Level
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
 }
 
 // Flush flushes the file system's in-memory copy
@@ -0,0 +1,61 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import "time"
+
+const (
+	// DefaultMinBackoff is the default delay before the first reconnection
+	DefaultMinBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff is the default maximum delay between reconnections
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// backoff delays retries exponentially, from min to max
+type backoff struct {
+	min   time.Duration
+	max   time.Duration
+	delay time.Duration
+	next  time.Time
+}
+
+// ready checks if it is time to retry
+func (b *backoff) ready(now time.Time) bool {
+	return !now.Before(b.next)
+}
+
+// fail doubles the delay and schedules the next retry
+func (b *backoff) fail(now time.Time) {
+	min, max := b.min, b.max
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+
+	if b.delay == 0 {
+		b.delay = min
+	} else if b.delay *= 2; b.delay > max {
+		b.delay = max
+	}
+	b.next = now.Add(b.delay)
+}
+
+// reset resets the delay after a successful retry
+func (b *backoff) reset() {
+	b.delay = 0
+	b.next = time.Time{}
+}
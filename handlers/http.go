@@ -0,0 +1,554 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zoumo/logdog"
+	"github.com/zoumo/logdog/pkg/pythonic"
+)
+
+const (
+	// EncodingJSON posts a batch as a JSON array
+	EncodingJSON = "json"
+	// EncodingNDJSON posts a batch as newline delimited JSON
+	EncodingNDJSON = "ndjson"
+
+	// DefaultMaxBatchCount is the default maximum number of records in a batch
+	DefaultMaxBatchCount = 100
+	// DefaultMaxBatchBytes is the default maximum size in bytes of a batch
+	DefaultMaxBatchBytes = 1 << 20
+	// DefaultLinger is the default time a record waits for a batch to fill up
+	DefaultLinger = time.Second
+	// DefaultHTTPTimeout is the default timeout of a request
+	DefaultHTTPTimeout = 10 * time.Second
+	// DefaultMaxRetries is the default number of retries of a batch
+	DefaultMaxRetries = 3
+	// DefaultMaxPendingBatches is the default maximum number of batches waiting to be posted
+	DefaultMaxPendingBatches = 16
+)
+
+var errBatchOverflow = errors.New("too many batches waiting to be posted")
+
+// DeadLetterFunc is called with the formatted records of a batch
+// which can not be posted after all retries
+type DeadLetterFunc func(records []string, err error)
+
+// httpStatusError is returned for a response with a non-2xx status
+type httpStatusError struct {
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %d %s", e.code, http.StatusText(e.code))
+}
+
+// retryable checks if the request should be retried
+func (e *httpStatusError) retryable() bool {
+	return e.code >= 500 || e.code == http.StatusTooManyRequests
+}
+
+// httpBatch is a batch of formatted records, or a flush request if done is not nil
+type httpBatch struct {
+	records []string
+	done    chan struct{}
+}
+
+// HTTPHandler is a handler which batches records and posts them
+// to URL as a JSON array or newline delimited JSON.
+//
+// A batch is posted when it holds MaxBatchCount records or MaxBatchBytes
+// bytes, or Linger after its first record is emitted. Batches are posted
+// one by one in a background goroutine, a batch failing with a network error,
+// 5xx or 429 is retried up to MaxRetries times with exponential backoff,
+// Retry-After of the response is honored but capped at MaxBackoff. A batch which can not be posted
+// is passed to DeadLetter, or reported to stderr if DeadLetter is nil.
+//
+// If MaxPendingBatches batches are already waiting to be posted, e.g. the
+// endpoint is slow, a new batch is handled by Overflow. It drops the oldest
+// batch by default, so that Emit never waits for the endpoint. Dropped
+// batches are passed to DeadLetter too.
+//
+// Formatter must convert a record to a JSON object, it is a JSONFormatter by default.
+type HTTPHandler struct {
+	Name      string
+	Level     logdog.Level
+	Formatter logdog.Formatter
+
+	URL        string
+	Headers    map[string]string
+	Encoding   string
+	Gzip       bool
+	Client     *http.Client
+	DeadLetter DeadLetterFunc
+
+	MaxBatchCount int
+	MaxBatchBytes int
+	Linger        time.Duration
+	MaxRetries    int
+	MinBackoff    time.Duration
+	MaxBackoff    time.Duration
+
+	MaxPendingBatches int
+	Overflow          OverflowPolicy
+	logdog.Filterer
+
+	batch      []string
+	batchBytes int
+	generation int
+	pending    []httpBatch
+	waiting    int
+	started    bool
+	closed     bool
+	cond       *sync.Cond
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+}
+
+// NewHTTPHandler returns a new HTTPHandler posting records to url
+func NewHTTPHandler(url string, options ...logdog.Option) *HTTPHandler {
+	hdlr := &HTTPHandler{
+		Name:          "",
+		Level:         logdog.NothingLevel,
+		Formatter:     logdog.NewJSONFormatter(),
+		URL:           url,
+		Headers:       map[string]string{},
+		Encoding:      EncodingJSON,
+		Client:        &http.Client{Timeout: DefaultHTTPTimeout},
+		MaxBatchCount: DefaultMaxBatchCount,
+		MaxBatchBytes: DefaultMaxBatchBytes,
+		Linger:        DefaultLinger,
+		MaxRetries:    DefaultMaxRetries,
+		MinBackoff:    DefaultMinBackoff,
+		MaxBackoff:    DefaultMaxBackoff,
+
+		MaxPendingBatches: DefaultMaxPendingBatches,
+		Overflow:          OverflowDropOldest,
+	}
+	hdlr.cond = sync.NewCond(&hdlr.mu)
+
+	hdlr.ApplyOptions(options...)
+
+	return hdlr
+}
+
+// ApplyOptions applys all option to HTTPHandler
+func (hdlr *HTTPHandler) ApplyOptions(options ...logdog.Option) *HTTPHandler {
+	logdog.ApplyOptionsTo(hdlr, options...)
+	return hdlr
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (hdlr *HTTPHandler) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	hdlr.Name = config.MustGetString("name", "")
+	hdlr.Level = logdog.GetLevel(config.MustGetString("level", "NOTHING"))
+
+	if _formatter := config.MustGetString("formatter", ""); _formatter != "" {
+		formatter := logdog.GetFormatter(_formatter)
+		if formatter == nil {
+			return fmt.Errorf("can not find formatter: %s", _formatter)
+		}
+		hdlr.Formatter = formatter
+	}
+
+	hdlr.URL = config.MustGetString("url", "")
+	for k, v := range config.MustGetDict("headers") {
+		hdlr.Headers[fmt.Sprint(k)] = fmt.Sprint(v)
+	}
+	hdlr.Encoding = config.MustGetString("encoding", EncodingJSON)
+	if hdlr.Encoding != EncodingJSON && hdlr.Encoding != EncodingNDJSON {
+		return fmt.Errorf("unknown encoding: %s", hdlr.Encoding)
+	}
+	hdlr.Gzip = config.MustGetBool("gzip", false)
+	hdlr.MaxBatchCount = config.MustGetInt("maxBatchCount", DefaultMaxBatchCount)
+	hdlr.MaxBatchBytes = config.MustGetInt("maxBatchBytes", DefaultMaxBatchBytes)
+	hdlr.MaxRetries = config.MustGetInt("maxRetries", DefaultMaxRetries)
+	hdlr.MaxPendingBatches = config.MustGetInt("maxPendingBatches", DefaultMaxPendingBatches)
+	if hdlr.Overflow, err = GetOverflowPolicy(config.MustGetString("overflow", "dropOldest")); err != nil {
+		return err
+	}
+
+	for key, d := range map[string]*time.Duration{
+		"linger":     &hdlr.Linger,
+		"timeout":    &hdlr.Client.Timeout,
+		"minBackoff": &hdlr.MinBackoff,
+		"maxBackoff": &hdlr.MaxBackoff,
+	} {
+		if v := config.MustGetString(key, ""); v != "" {
+			if *d, err = time.ParseDuration(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	filters, err := logdog.LoadFilters(c)
+	if err != nil {
+		return err
+	}
+	hdlr.AddFilters(filters...)
+	if hdlr.LevelMask, err = logdog.LoadLevelMask(c); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Emit adds log record to the current batch
+func (hdlr *HTTPHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Filter(record) {
+		return
+	}
+
+	msg, err := hdlr.Formatter.Format(record)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Format record failed, [%v]\n", err)
+		return
+	}
+
+	hdlr.mu.Lock()
+	// records emitted after Close are dropped
+	if hdlr.closed {
+		hdlr.mu.Unlock()
+		return
+	}
+	if !hdlr.started {
+		hdlr.start()
+	}
+
+	var dropped []string
+	// post the current batch first if msg does not fit in it
+	if len(hdlr.batch) > 0 && hdlr.batchBytes+len(msg)+1 > hdlr.MaxBatchBytes {
+		dropped = hdlr.cut()
+	}
+
+	hdlr.batch = append(hdlr.batch, msg)
+	hdlr.batchBytes += len(msg) + 1
+
+	if len(hdlr.batch) >= hdlr.MaxBatchCount || hdlr.batchBytes >= hdlr.MaxBatchBytes {
+		dropped = append(dropped, hdlr.cut()...)
+	} else if len(hdlr.batch) == 1 {
+		generation := hdlr.generation
+		time.AfterFunc(hdlr.Linger, func() {
+			hdlr.linger(generation)
+		})
+	}
+	hdlr.mu.Unlock()
+
+	hdlr.drop(dropped)
+}
+
+// Enabled checks if handler takes records at level
+func (hdlr *HTTPHandler) Enabled(level logdog.Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level)
+}
+
+// Filter checks if handler should filter the specified record
+func (hdlr *HTTPHandler) Filter(record *logdog.LogRecord) bool {
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
+}
+
+// Flush posts the current batch and blocks until all batches are posted
+func (hdlr *HTTPHandler) Flush() error {
+	hdlr.mu.Lock()
+	if hdlr.closed || !hdlr.started {
+		hdlr.mu.Unlock()
+		return nil
+	}
+	dropped := hdlr.cut()
+	// a flush request is never dropped
+	done := make(chan struct{})
+	hdlr.pending = append(hdlr.pending, httpBatch{done: done})
+	hdlr.cond.Broadcast()
+	hdlr.mu.Unlock()
+
+	hdlr.drop(dropped)
+	<-done
+	return nil
+}
+
+// Close posts all batches and stops the background goroutine
+func (hdlr *HTTPHandler) Close() error {
+	hdlr.mu.Lock()
+	if hdlr.closed {
+		hdlr.mu.Unlock()
+		return nil
+	}
+	hdlr.closed = true
+	var dropped []string
+	if hdlr.started {
+		dropped = hdlr.cut()
+		// wake up the background goroutine to exit
+		hdlr.cond.Broadcast()
+	}
+	hdlr.mu.Unlock()
+
+	hdlr.drop(dropped)
+	hdlr.wg.Wait()
+	return nil
+}
+
+// start starts the background goroutine, hdlr.mu must be held
+func (hdlr *HTTPHandler) start() {
+	if hdlr.cond == nil {
+		hdlr.cond = sync.NewCond(&hdlr.mu)
+	}
+	hdlr.started = true
+	hdlr.wg.Add(1)
+	go hdlr.run()
+}
+
+// run posts pending batches one by one until the handler is closed
+// and all batches are posted
+func (hdlr *HTTPHandler) run() {
+	defer hdlr.wg.Done()
+	for {
+		hdlr.mu.Lock()
+		for len(hdlr.pending) == 0 && !(hdlr.closed && hdlr.waiting == 0) {
+			hdlr.cond.Wait()
+		}
+		if len(hdlr.pending) == 0 {
+			hdlr.mu.Unlock()
+			return
+		}
+		batch := hdlr.pending[0]
+		hdlr.pending = hdlr.pending[1:]
+		// wake up Emit waiting for room
+		hdlr.cond.Broadcast()
+		hdlr.mu.Unlock()
+
+		if batch.done != nil {
+			close(batch.done)
+			continue
+		}
+		hdlr.post(batch.records)
+	}
+}
+
+// linger posts the batch of generation if it is still the current batch
+func (hdlr *HTTPHandler) linger(generation int) {
+	hdlr.mu.Lock()
+	var dropped []string
+	if !hdlr.closed && generation == hdlr.generation {
+		dropped = hdlr.cut()
+	}
+	hdlr.mu.Unlock()
+
+	hdlr.drop(dropped)
+}
+
+// cut hands the current batch over to the background goroutine,
+// returns the records dropped by Overflow.
+// hdlr.mu must be held
+func (hdlr *HTTPHandler) cut() []string {
+	if len(hdlr.batch) == 0 {
+		return nil
+	}
+	batch := httpBatch{records: hdlr.batch}
+	hdlr.batch = nil
+	hdlr.batchBytes = 0
+	hdlr.generation++
+
+	var dropped []string
+	if max := hdlr.MaxPendingBatches; max > 0 && len(hdlr.pending) >= max {
+		switch hdlr.Overflow {
+		case OverflowDropNewest:
+			return batch.records
+		case OverflowDropOldest:
+			// flush requests are kept
+			for i, pending := range hdlr.pending {
+				if pending.done == nil {
+					dropped = pending.records
+					hdlr.pending = append(hdlr.pending[:i], hdlr.pending[i+1:]...)
+					break
+				}
+			}
+		default:
+			hdlr.waiting++
+			for len(hdlr.pending) >= max {
+				hdlr.cond.Wait()
+			}
+			hdlr.waiting--
+		}
+	}
+
+	hdlr.pending = append(hdlr.pending, batch)
+	hdlr.cond.Broadcast()
+	return dropped
+}
+
+// drop passes records dropped by Overflow to DeadLetter
+func (hdlr *HTTPHandler) drop(records []string) {
+	if len(records) > 0 {
+		hdlr.deadLetter(records, errBatchOverflow)
+	}
+}
+
+// post posts records with retries, records are passed to
+// DeadLetter if it fails
+func (hdlr *HTTPHandler) post(records []string) {
+	body, err := hdlr.encode(records)
+	if err != nil {
+		hdlr.deadLetter(records, err)
+		return
+	}
+
+	delay := hdlr.MinBackoff
+	for i := 0; ; i++ {
+		err = hdlr.do(body)
+		if err == nil {
+			return
+		}
+
+		wait := delay
+		if e, ok := err.(*httpStatusError); ok {
+			if !e.retryable() {
+				break
+			}
+			if e.retryAfter > 0 {
+				wait = e.retryAfter
+				if wait > hdlr.MaxBackoff {
+					wait = hdlr.MaxBackoff
+				}
+			}
+		}
+		if i >= hdlr.MaxRetries {
+			break
+		}
+
+		time.Sleep(wait)
+		if delay *= 2; delay > hdlr.MaxBackoff {
+			delay = hdlr.MaxBackoff
+		}
+	}
+
+	hdlr.deadLetter(records, err)
+}
+
+func (hdlr *HTTPHandler) deadLetter(records []string, err error) {
+	if hdlr.DeadLetter != nil {
+		hdlr.DeadLetter(records, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Post %d records to %s failed, [%v]\n", len(records), hdlr.URL, err)
+}
+
+// encode encodes records as the request body
+func (hdlr *HTTPHandler) encode(records []string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	var zw *gzip.Writer
+	if hdlr.Gzip {
+		zw = gzip.NewWriter(buf)
+		w = zw
+	}
+
+	if hdlr.Encoding == EncodingNDJSON {
+		for _, record := range records {
+			io.WriteString(w, record)
+			io.WriteString(w, "\n")
+		}
+	} else {
+		io.WriteString(w, "[")
+		for i, record := range records {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			io.WriteString(w, record)
+		}
+		io.WriteString(w, "]")
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// do sends a request with body
+func (hdlr *HTTPHandler) do(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hdlr.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if hdlr.Encoding == EncodingNDJSON {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if hdlr.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range hdlr.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := hdlr.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body to reuse the connection
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &httpStatusError{
+		code:       resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter parses Retry-After in delay-seconds or HTTP-date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func init() {
+	logdog.RegisterConstructor("HTTPHandler", func() logdog.ConfigLoader {
+		return NewHTTPHandler("")
+	})
+}
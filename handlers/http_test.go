@@ -0,0 +1,334 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+)
+
+// batchServer records the bodies of all requests, and responds
+// with the status codes in order, then 200
+type batchServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   []string
+	requests []*http.Request
+	codes    []int
+}
+
+func newBatchServer(codes ...int) *batchServer {
+	s := &batchServer{codes: codes}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reader = zr
+		}
+		body, _ := io.ReadAll(reader)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.bodies = append(s.bodies, string(body))
+		s.requests = append(s.requests, r)
+		if len(s.codes) > 0 {
+			code := s.codes[0]
+			s.codes = s.codes[1:]
+			if code == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			w.WriteHeader(code)
+		}
+	}))
+	return s
+}
+
+func (s *batchServer) Bodies() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func messagesOf(t *testing.T, body string) []string {
+	records := []map[string]interface{}{}
+	if err := json.Unmarshal([]byte(body), &records); err != nil {
+		t.Fatal(err)
+	}
+	messages := []string{}
+	for _, record := range records {
+		messages = append(messages, record["message"].(string))
+	}
+	return messages
+}
+
+func TestHTTPHandlerBatchCount(t *testing.T) {
+	server := newBatchServer()
+	defer server.Close()
+
+	hdlr := NewHTTPHandler(server.URL)
+	hdlr.MaxBatchCount = 2
+	hdlr.Linger = time.Hour
+
+	for _, msg := range []string{"1", "2", "3"} {
+		hdlr.Emit(newRecord(msg))
+	}
+	assert.Nil(t, hdlr.Flush())
+
+	bodies := server.Bodies()
+	assert.Len(t, bodies, 2)
+	assert.Equal(t, []string{"1", "2"}, messagesOf(t, bodies[0]))
+	assert.Equal(t, []string{"3"}, messagesOf(t, bodies[1]))
+	assert.Equal(t, "application/json", server.requests[0].Header.Get("Content-Type"))
+	assert.Nil(t, hdlr.Close())
+}
+
+func TestHTTPHandlerBatchBytes(t *testing.T) {
+	server := newBatchServer()
+	defer server.Close()
+
+	hdlr := NewHTTPHandler(server.URL)
+	msg, _ := hdlr.Formatter.Format(newRecord("1"))
+	// room for two records
+	hdlr.MaxBatchBytes = 2*len(msg) + 3
+	hdlr.Linger = time.Hour
+
+	for _, msg := range []string{"1", "2", "3"} {
+		hdlr.Emit(newRecord(msg))
+	}
+	assert.Nil(t, hdlr.Close())
+
+	bodies := server.Bodies()
+	assert.Len(t, bodies, 2)
+	assert.Equal(t, []string{"1", "2"}, messagesOf(t, bodies[0]))
+	assert.Equal(t, []string{"3"}, messagesOf(t, bodies[1]))
+}
+
+func TestHTTPHandlerLinger(t *testing.T) {
+	server := newBatchServer()
+	defer server.Close()
+
+	hdlr := NewHTTPHandler(server.URL)
+	hdlr.Linger = 10 * time.Millisecond
+	defer hdlr.Close()
+
+	hdlr.Emit(newRecord("linger"))
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.Bodies()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	bodies := server.Bodies()
+	if assert.Len(t, bodies, 1) {
+		assert.Equal(t, []string{"linger"}, messagesOf(t, bodies[0]))
+	}
+}
+
+func TestHTTPHandlerNDJSONGzip(t *testing.T) {
+	server := newBatchServer()
+	defer server.Close()
+
+	hdlr := NewHTTPHandler(server.URL)
+	hdlr.Encoding = EncodingNDJSON
+	hdlr.Gzip = true
+	hdlr.Headers["Authorization"] = "Bearer token"
+
+	hdlr.Emit(newRecord("1"))
+	hdlr.Emit(newRecord("2"))
+	assert.Nil(t, hdlr.Close())
+
+	bodies := server.Bodies()
+	if assert.Len(t, bodies, 1) {
+		lines := strings.Split(strings.TrimSuffix(bodies[0], "\n"), "\n")
+		assert.Len(t, lines, 2)
+		assert.Equal(t, []string{"1", "2"}, messagesOf(t, "["+strings.Join(lines, ",")+"]"))
+	}
+	req := server.requests[0]
+	assert.Equal(t, "application/x-ndjson", req.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+}
+
+func TestHTTPHandlerRetry(t *testing.T) {
+	server := newBatchServer(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer server.Close()
+
+	hdlr := NewHTTPHandler(server.URL)
+	hdlr.MinBackoff = time.Millisecond
+	// Retry-After is capped
+	hdlr.MaxBackoff = 10 * time.Millisecond
+	hdlr.DeadLetter = func(records []string, err error) {
+		t.Errorf("unexpected dead letter: %v", err)
+	}
+
+	hdlr.Emit(newRecord("retry"))
+	assert.Nil(t, hdlr.Close())
+
+	bodies := server.Bodies()
+	assert.Len(t, bodies, 3)
+	assert.Equal(t, bodies[0], bodies[2])
+}
+
+func TestHTTPHandlerDeadLetter(t *testing.T) {
+	server := newBatchServer(http.StatusBadRequest, 500, 500, 500)
+	defer server.Close()
+
+	var (
+		dead []string
+		errs []error
+	)
+	hdlr := NewHTTPHandler(server.URL)
+	hdlr.MinBackoff = time.Millisecond
+	hdlr.MaxRetries = 2
+	hdlr.DeadLetter = func(records []string, err error) {
+		dead = append(dead, records...)
+		errs = append(errs, err)
+	}
+
+	// 400 is not retried
+	hdlr.Emit(newRecord("bad"))
+	assert.Nil(t, hdlr.Flush())
+	assert.Len(t, server.Bodies(), 1)
+
+	// 500 is retried MaxRetries times
+	hdlr.Emit(newRecord("unavailable"))
+	assert.Nil(t, hdlr.Close())
+	assert.Len(t, server.Bodies(), 4)
+
+	if assert.Len(t, dead, 2) {
+		assert.Equal(t, []string{"bad"}, messagesOf(t, "["+dead[0]+"]"))
+		assert.Contains(t, errs[0].Error(), "400")
+		assert.Contains(t, errs[1].Error(), "500")
+	}
+
+	// records emitted after Close are discarded
+	hdlr.Emit(newRecord("closed"))
+	assert.Len(t, server.Bodies(), 4)
+}
+
+func TestHTTPHandlerEmitAfterClose(t *testing.T) {
+	server := newBatchServer()
+	defer server.Close()
+
+	hdlr := NewHTTPHandler(server.URL)
+	assert.Nil(t, hdlr.Close())
+
+	// no background goroutine is started after Close
+	hdlr.Emit(newRecord("closed"))
+	assert.False(t, hdlr.started)
+	assert.Nil(t, hdlr.Flush())
+	assert.Nil(t, hdlr.Close())
+	assert.Empty(t, server.Bodies())
+}
+
+func TestHTTPHandlerOverflow(t *testing.T) {
+	for _, c := range []struct {
+		policy OverflowPolicy
+		posted []string
+		dead   []string
+	}{
+		{OverflowDropOldest, []string{"1", "4"}, []string{"2", "3"}},
+		{OverflowDropNewest, []string{"1", "2"}, []string{"3", "4"}},
+	} {
+		received := make(chan string, 4)
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received <- messagesOf(t, string(body))[0]
+			<-release
+		}))
+
+		var dead []string
+		hdlr := NewHTTPHandler(server.URL)
+		hdlr.MaxBatchCount = 1
+		hdlr.MaxPendingBatches = 1
+		hdlr.Overflow = c.policy
+		hdlr.DeadLetter = func(records []string, err error) {
+			assert.Equal(t, errBatchOverflow, err)
+			dead = append(dead, messagesOf(t, "["+strings.Join(records, ",")+"]")...)
+		}
+
+		// the endpoint is stuck in posting the first batch,
+		// Emit does not wait for it
+		hdlr.Emit(newRecord("1"))
+		assert.Equal(t, "1", <-received)
+		for _, msg := range []string{"2", "3", "4"} {
+			hdlr.Emit(newRecord(msg))
+		}
+		assert.Equal(t, c.dead, dead, c.policy.String())
+
+		close(release)
+		assert.Nil(t, hdlr.Close())
+		close(received)
+		posted := []string{"1"}
+		for msg := range received {
+			posted = append(posted, msg)
+		}
+		assert.Equal(t, c.posted, posted, c.policy.String())
+		server.Close()
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+
+	d := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, d > 59*time.Minute && d <= time.Hour, d)
+}
+
+func TestHTTPHandlerLoadConfig(t *testing.T) {
+	hdlr := NewHTTPHandler("")
+	err := hdlr.LoadConfig(map[string]interface{}{
+		"name":          "http",
+		"level":         "INFO",
+		"url":           "http://localhost/logs",
+		"headers":       map[string]interface{}{"X-Token": "secret"},
+		"encoding":      "ndjson",
+		"gzip":          true,
+		"maxBatchCount": 10,
+		"linger":        "100ms",
+		"timeout":       "3s",
+		"overflow":      "block",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "http", hdlr.Name)
+	assert.Equal(t, logdog.InfoLevel, hdlr.Level)
+	assert.Equal(t, "http://localhost/logs", hdlr.URL)
+	assert.Equal(t, map[string]string{"X-Token": "secret"}, hdlr.Headers)
+	assert.Equal(t, EncodingNDJSON, hdlr.Encoding)
+	assert.True(t, hdlr.Gzip)
+	assert.Equal(t, 10, hdlr.MaxBatchCount)
+	assert.Equal(t, DefaultMaxBatchBytes, hdlr.MaxBatchBytes)
+	assert.Equal(t, 100*time.Millisecond, hdlr.Linger)
+	assert.Equal(t, 3*time.Second, hdlr.Client.Timeout)
+	assert.Equal(t, OverflowBlock, hdlr.Overflow)
+	assert.Equal(t, DefaultMaxPendingBatches, hdlr.MaxPendingBatches)
+
+	assert.NotNil(t, hdlr.LoadConfig(map[string]interface{}{"encoding": "xml"}))
+	assert.NotNil(t, hdlr.LoadConfig(map[string]interface{}{"overflow": "unknown"}))
+}
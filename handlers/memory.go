@@ -0,0 +1,181 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zoumo/logdog"
+	"github.com/zoumo/logdog/pkg/pythonic"
+)
+
+const (
+	// DefaultMemoryCapacity is the default capacity of MemoryHandler
+	DefaultMemoryCapacity = 100
+)
+
+// MemoryHandler is a handler which buffers records in memory, likes
+// python's MemoryHandler. The buffered records are sent to Target when
+// a record at or above FlushLevel arrives, when the buffer is full or
+// on Flush. So debug records appear only around failures.
+type MemoryHandler struct {
+	Name         string
+	Level        logdog.Level
+	Capacity     int
+	FlushLevel   logdog.Level
+	FlushOnClose bool
+	Target       logdog.Handler
+	logdog.Filterer
+
+	buffer []*logdog.LogRecord
+	mu     sync.Mutex
+}
+
+// NewMemoryHandler returns a new MemoryHandler fully initialized
+func NewMemoryHandler(capacity int, flushLevel logdog.Level, target logdog.Handler, options ...logdog.Option) *MemoryHandler {
+	hdlr := &MemoryHandler{
+		Name:         "",
+		Level:        logdog.NothingLevel,
+		Capacity:     capacity,
+		FlushLevel:   flushLevel,
+		FlushOnClose: true,
+		Target:       target,
+	}
+
+	hdlr.ApplyOptions(options...)
+
+	return hdlr
+}
+
+// ApplyOptions applys all option to MemoryHandler
+func (hdlr *MemoryHandler) ApplyOptions(options ...logdog.Option) *MemoryHandler {
+	logdog.ApplyOptionsTo(hdlr, options...)
+	return hdlr
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (hdlr *MemoryHandler) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	hdlr.Name = config.MustGetString("name", "")
+	hdlr.Level = logdog.GetLevel(config.MustGetString("level", "NOTHING"))
+	hdlr.Capacity = config.MustGetInt("capacity", DefaultMemoryCapacity)
+	hdlr.FlushLevel = logdog.GetLevel(config.MustGetString("flushLevel", "ERROR"))
+	hdlr.FlushOnClose = config.MustGetBool("flushOnClose", true)
+
+	target := config.MustGetString("target", "")
+	if target != "" {
+		hdlr.Target = logdog.GetHandler(target)
+		if hdlr.Target == nil {
+			return fmt.Errorf("can not find handler: %s", target)
+		}
+	}
+
+	filters, err := logdog.LoadFilters(c)
+	if err != nil {
+		return err
+	}
+	hdlr.AddFilters(filters...)
+	if hdlr.LevelMask, err = logdog.LoadLevelMask(c); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Emit buffers the record, and sends all buffered records
+// to Target if it should flush
+func (hdlr *MemoryHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Filter(record) {
+		return
+	}
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	hdlr.buffer = append(hdlr.buffer, record)
+	if hdlr.shouldFlush(record) {
+		hdlr.flush()
+	}
+}
+
+// Enabled checks if handler takes records at level
+func (hdlr *MemoryHandler) Enabled(level logdog.Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level)
+}
+
+// Filter checks if handler should filter the specified record
+func (hdlr *MemoryHandler) Filter(record *logdog.LogRecord) bool {
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
+}
+
+// shouldFlush checks for buffer full or a record at the FlushLevel or higher
+func (hdlr *MemoryHandler) shouldFlush(record *logdog.LogRecord) bool {
+	return len(hdlr.buffer) >= hdlr.Capacity || record.Level >= hdlr.FlushLevel
+}
+
+// flush sends the buffered records to Target and clears the buffer,
+// records are dropped if there is no Target
+func (hdlr *MemoryHandler) flush() {
+	if hdlr.Target != nil {
+		for _, record := range hdlr.buffer {
+			hdlr.Target.Emit(record)
+		}
+	}
+	hdlr.buffer = hdlr.buffer[:0]
+}
+
+// Len returns the number of buffered records
+func (hdlr *MemoryHandler) Len() int {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	return len(hdlr.buffer)
+}
+
+// Flush sends the buffered records to Target, then flushes Target
+func (hdlr *MemoryHandler) Flush() error {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	hdlr.flush()
+	if hdlr.Target == nil {
+		return nil
+	}
+	return hdlr.Target.Flush()
+}
+
+// Close sends the buffered records to Target if FlushOnClose is true,
+// otherwise they are dropped. Target is not closed.
+func (hdlr *MemoryHandler) Close() error {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	if hdlr.FlushOnClose {
+		hdlr.flush()
+	}
+	hdlr.buffer = nil
+	return nil
+}
+
+func init() {
+	logdog.RegisterConstructor("MemoryHandler", func() logdog.ConfigLoader {
+		return NewMemoryHandler(DefaultMemoryCapacity, logdog.ErrorLevel, nil)
+	})
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+)
+
+func newLevelRecord(level logdog.Level, msg string) *logdog.LogRecord {
+	return logdog.NewLogRecord("test", level, "test/record", "test/test.record", 1, msg)
+}
+
+func TestMemoryHandlerFlushLevel(t *testing.T) {
+	target := &memHandler{}
+	hdlr := NewMemoryHandler(10, logdog.ErrorLevel, target, logdog.DebugLevel)
+
+	hdlr.Emit(newLevelRecord(logdog.DebugLevel, "debug"))
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "info"))
+	assert.Empty(t, target.Messages())
+	assert.Equal(t, 2, hdlr.Len())
+
+	hdlr.Emit(newLevelRecord(logdog.ErrorLevel, "error"))
+	assert.Equal(t, []string{"debug", "info", "error"}, target.Messages())
+	assert.Equal(t, 0, hdlr.Len())
+}
+
+func TestMemoryHandlerCapacity(t *testing.T) {
+	target := &memHandler{}
+	hdlr := NewMemoryHandler(2, logdog.ErrorLevel, target)
+
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "1"))
+	assert.Empty(t, target.Messages())
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "2"))
+	assert.Equal(t, []string{"1", "2"}, target.Messages())
+}
+
+func TestMemoryHandlerFlushAndClose(t *testing.T) {
+	target := &memHandler{}
+	hdlr := NewMemoryHandler(10, logdog.ErrorLevel, target)
+
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "1"))
+	assert.Nil(t, hdlr.Flush())
+	assert.Equal(t, []string{"1"}, target.Messages())
+	assert.Equal(t, 1, target.flushed)
+
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "2"))
+	assert.Nil(t, hdlr.Close())
+	assert.Equal(t, []string{"1", "2"}, target.Messages())
+
+	target = &memHandler{}
+	hdlr = NewMemoryHandler(10, logdog.ErrorLevel, target)
+	hdlr.FlushOnClose = false
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "1"))
+	assert.Nil(t, hdlr.Close())
+	assert.Empty(t, target.Messages())
+}
+
+func TestMemoryHandlerLoadJSONConfig(t *testing.T) {
+	config := []byte(`{
+        "handlers": {
+            "memory": {
+                "class": "MemoryHandler",
+                "capacity": 50,
+                "flushLevel": "FATAL",
+                "flushOnClose": false,
+                "target": "memoryTarget"
+            },
+            "memoryTarget": {
+                "class": "NullHandler"
+            }
+        }
+    }`)
+
+	err := logdog.LoadJSONConfig(config)
+	assert.Nil(t, err)
+
+	hdlr, ok := logdog.GetHandler("memory").(*MemoryHandler)
+	assert.True(t, ok)
+	assert.Equal(t, 50, hdlr.Capacity)
+	assert.Equal(t, logdog.FatalLevel, hdlr.FlushLevel)
+	assert.False(t, hdlr.FlushOnClose)
+	assert.Equal(t, logdog.GetHandler("memoryTarget"), hdlr.Target)
+
+	err = NewMemoryHandler(1, logdog.ErrorLevel, nil).LoadConfig(logdog.Config{
+		"target": "notExist",
+	})
+	assert.Error(t, err)
+}
+
+func TestMemoryHandlerInterface(t *testing.T) {
+	assert.Implements(t, (*logdog.Handler)(nil), NewMemoryHandler(1, logdog.ErrorLevel, nil))
+	assert.Implements(t, (*logdog.ConfigLoader)(nil), NewMemoryHandler(1, logdog.ErrorLevel, nil))
+}
@@ -0,0 +1,360 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zoumo/logdog"
+)
+
+const (
+	// DefaultQueueSize is the default capacity of RecordQueue
+	DefaultQueueSize = 1024
+)
+
+// OverflowPolicy decides what RecordQueue does when it is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until there is room in the queue
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the record being put
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest record in the queue
+	// to make room for the record being put
+	OverflowDropOldest
+)
+
+var overflowPolicyNames = map[OverflowPolicy]string{
+	OverflowBlock:      "block",
+	OverflowDropNewest: "dropNewest",
+	OverflowDropOldest: "dropOldest",
+}
+
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("OverflowPolicy %d", int(p))
+}
+
+// GetOverflowPolicy returns the OverflowPolicy with the given name
+func GetOverflowPolicy(name string) (OverflowPolicy, error) {
+	for p, n := range overflowPolicyNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return OverflowBlock, fmt.Errorf("unknown overflow policy: %s", name)
+}
+
+// RecordQueue is a bounded queue of LogRecord, which is
+// shared by QueueHandler and QueueListener.
+//
+// Like python's queue.Queue, every record got from the queue should be
+// marked as done by Done, and Join blocks until all records are done.
+// Put blocked by a full queue returns when the queue is closed.
+type RecordQueue struct {
+	Policy OverflowPolicy
+
+	records chan *logdog.LogRecord
+	dropped uint64
+	// listeners is the number of running QueueListener
+	listeners int32
+
+	mu      sync.RWMutex
+	closed  bool
+	closing chan struct{}
+	// senders are the calls of Put in flight,
+	// records is closed after all of them return
+	senders sync.WaitGroup
+
+	pendingMu sync.Mutex
+	pending   int
+	allDone   *sync.Cond
+}
+
+// NewRecordQueue returns a RecordQueue with the given capacity and OverflowPolicy
+func NewRecordQueue(size int, policy OverflowPolicy) *RecordQueue {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	q := &RecordQueue{
+		Policy:  policy,
+		records: make(chan *logdog.LogRecord, size),
+		closing: make(chan struct{}),
+	}
+	q.allDone = sync.NewCond(&q.pendingMu)
+	return q
+}
+
+// Put puts record into the queue, returns false if the record is dropped
+// or the queue is closed
+func (q *RecordQueue) Put(record *logdog.LogRecord) bool {
+	q.mu.RLock()
+	if q.closed {
+		q.mu.RUnlock()
+		atomic.AddUint64(&q.dropped, 1)
+		return false
+	}
+	q.senders.Add(1)
+	q.mu.RUnlock()
+	defer q.senders.Done()
+
+	q.pendingMu.Lock()
+	q.pending++
+	q.pendingMu.Unlock()
+
+	switch q.Policy {
+	case OverflowDropNewest:
+		select {
+		case q.records <- record:
+		default:
+			q.drop()
+			return false
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case q.records <- record:
+				return true
+			default:
+			}
+			// make room for the record
+			select {
+			case <-q.records:
+				q.drop()
+			default:
+			}
+		}
+	default:
+		select {
+		case q.records <- record:
+		case <-q.closing:
+			q.drop()
+			return false
+		}
+	}
+
+	return true
+}
+
+// drop counts a dropped record and marks it as done
+func (q *RecordQueue) drop() {
+	atomic.AddUint64(&q.dropped, 1)
+	q.Done()
+}
+
+// Get removes and returns a record from the queue, it blocks until
+// a record is available. ok is false if the queue is closed and empty.
+func (q *RecordQueue) Get() (record *logdog.LogRecord, ok bool) {
+	record, ok = <-q.records
+	return
+}
+
+// Done marks a record got from the queue as done
+func (q *RecordQueue) Done() {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	q.pending--
+	if q.pending <= 0 {
+		q.allDone.Broadcast()
+	}
+}
+
+// Join blocks until all records put into the queue are done or dropped
+func (q *RecordQueue) Join() {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	for q.pending > 0 {
+		q.allDone.Wait()
+	}
+}
+
+// Dropped returns the number of dropped records
+func (q *RecordQueue) Dropped() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// Len returns the number of records in the queue
+func (q *RecordQueue) Len() int {
+	return len(q.records)
+}
+
+// Close closes the queue, records put after it are dropped,
+// so are records of Put blocked by the full queue.
+// Records in the queue can still be got.
+func (q *RecordQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.closing)
+	q.mu.Unlock()
+
+	// no one sends to records after this
+	q.senders.Wait()
+	close(q.records)
+}
+
+// listening checks if a QueueListener is taking records from the queue
+func (q *RecordQueue) listening() bool {
+	return atomic.LoadInt32(&q.listeners) > 0
+}
+
+// QueueHandler is a handler which puts records into a RecordQueue,
+// so that logging does not wait for slow handlers. A QueueListener
+// takes records from the other end of the queue and emits them.
+//
+// Note that records are not copied, args and Fields passed to
+// the logging call should not be modified after that.
+type QueueHandler struct {
+	Name  string
+	Level logdog.Level
+	Queue *RecordQueue
+	logdog.Filterer
+}
+
+// NewQueueHandler returns a new QueueHandler putting records into queue
+func NewQueueHandler(queue *RecordQueue, options ...logdog.Option) *QueueHandler {
+	hdlr := &QueueHandler{
+		Name:  "",
+		Level: logdog.NothingLevel,
+		Queue: queue,
+	}
+
+	hdlr.ApplyOptions(options...)
+
+	return hdlr
+}
+
+// ApplyOptions applys all option to QueueHandler
+func (hdlr *QueueHandler) ApplyOptions(options ...logdog.Option) *QueueHandler {
+	logdog.ApplyOptionsTo(hdlr, options...)
+	return hdlr
+}
+
+// Emit puts record into the queue
+func (hdlr *QueueHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Filter(record) {
+		return
+	}
+	hdlr.Queue.Put(record)
+}
+
+// Enabled checks if handler takes records at level
+func (hdlr *QueueHandler) Enabled(level logdog.Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level)
+}
+
+// Filter checks if handler should filter the specified record
+func (hdlr *QueueHandler) Filter(record *logdog.LogRecord) bool {
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
+}
+
+// Dropped returns the number of records dropped by the queue
+func (hdlr *QueueHandler) Dropped() uint64 {
+	return hdlr.Queue.Dropped()
+}
+
+// Flush blocks until all records put into the queue are handled.
+// It returns at once if no QueueListener is running, records can not
+// be handled then.
+func (hdlr *QueueHandler) Flush() error {
+	if hdlr.Queue.listening() {
+		hdlr.Queue.Join()
+	}
+	return nil
+}
+
+// Close closes the queue and blocks until all records in the queue
+// are handled. Like Flush, it does not wait if no QueueListener is
+// running, records left in the queue can be handled by a listener
+// started later.
+func (hdlr *QueueHandler) Close() error {
+	hdlr.Queue.Close()
+	return hdlr.Flush()
+}
+
+// QueueListener takes records from a RecordQueue in a goroutine
+// and emits them to its handlers
+type QueueListener struct {
+	Queue    *RecordQueue
+	Handlers []logdog.Handler
+
+	wg sync.WaitGroup
+}
+
+// NewQueueListener returns a new QueueListener
+func NewQueueListener(queue *RecordQueue, handlers ...logdog.Handler) *QueueListener {
+	return &QueueListener{
+		Queue:    queue,
+		Handlers: handlers,
+	}
+}
+
+// Start starts a goroutine to handle records in the queue
+func (l *QueueListener) Start() *QueueListener {
+	l.wg.Add(1)
+	atomic.AddInt32(&l.Queue.listeners, 1)
+	go func() {
+		defer l.wg.Done()
+		defer atomic.AddInt32(&l.Queue.listeners, -1)
+		for {
+			record, ok := l.Queue.Get()
+			if !ok {
+				return
+			}
+			l.handle(record)
+			l.Queue.Done()
+		}
+	}()
+	return l
+}
+
+func (l *QueueListener) handle(record *logdog.LogRecord) {
+	for _, hdlr := range l.Handlers {
+		hdlr.Emit(record)
+	}
+}
+
+// Flush blocks until all records put into the queue are handled,
+// then flushes all handlers
+func (l *QueueListener) Flush() error {
+	l.Queue.Join()
+	for _, hdlr := range l.Handlers {
+		if err := hdlr.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Flush handler failed, [%v]\n", err)
+		}
+	}
+	return nil
+}
+
+// Stop closes the queue, handles all records left in it
+// and waits for the goroutine to exit, then flushes all handlers.
+// Handlers are not closed.
+func (l *QueueListener) Stop() {
+	l.Queue.Close()
+	l.wg.Wait()
+	l.Flush()
+}
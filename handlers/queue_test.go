@@ -0,0 +1,193 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+)
+
+// memHandler stores all emitted messages,
+// it blocks Emit until gate is closed if gate is not nil
+type memHandler struct {
+	gate     chan struct{}
+	mu       sync.Mutex
+	messages []string
+	records  []*logdog.LogRecord
+	flushed  int
+}
+
+func (hdlr *memHandler) Filter(*logdog.LogRecord) bool { return false }
+
+func (hdlr *memHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.gate != nil {
+		<-hdlr.gate
+	}
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	hdlr.messages = append(hdlr.messages, record.GetMessage())
+	hdlr.records = append(hdlr.records, record)
+}
+
+func (hdlr *memHandler) Flush() error {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	hdlr.flushed++
+	return nil
+}
+
+func (hdlr *memHandler) Close() error { return nil }
+
+func (hdlr *memHandler) Messages() []string {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	return append([]string(nil), hdlr.messages...)
+}
+
+func (hdlr *memHandler) Records() []*logdog.LogRecord {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	return append([]*logdog.LogRecord(nil), hdlr.records...)
+}
+
+func TestQueueHandler(t *testing.T) {
+	target := &memHandler{}
+	queue := NewRecordQueue(10, OverflowBlock)
+	listener := NewQueueListener(queue, target).Start()
+	hdlr := NewQueueHandler(queue, logdog.OptionName("queue"), logdog.InfoLevel)
+	assert.Equal(t, "queue", hdlr.Name)
+	assert.Equal(t, logdog.InfoLevel, hdlr.Level)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				hdlr.Emit(newRecord("msg"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Nil(t, hdlr.Flush())
+	assert.Len(t, target.Messages(), 1000)
+	assert.Equal(t, uint64(0), hdlr.Dropped())
+
+	debug := logdog.NewLogRecord("test", logdog.DebugLevel, "test/record", "test/test.record", 1, "debug")
+	hdlr.Emit(debug)
+	assert.Nil(t, hdlr.Close())
+	assert.Len(t, target.Messages(), 1000)
+
+	listener.Stop()
+	assert.Equal(t, 1, target.flushed)
+}
+
+func TestQueueHandlerDropNewest(t *testing.T) {
+	target := &memHandler{gate: make(chan struct{})}
+	queue := NewRecordQueue(2, OverflowDropNewest)
+	listener := NewQueueListener(queue, target).Start()
+	hdlr := NewQueueHandler(queue)
+
+	// the first one is taken by listener and blocks there
+	hdlr.Emit(newRecord("0"))
+	for queue.Len() > 0 {
+		runtime.Gosched()
+	}
+	for i := 1; i <= 5; i++ {
+		hdlr.Emit(newRecord(fmt.Sprint(i)))
+	}
+	assert.Equal(t, uint64(3), hdlr.Dropped())
+
+	close(target.gate)
+	listener.Stop()
+	assert.Equal(t, []string{"0", "1", "2"}, target.Messages())
+}
+
+func TestQueueHandlerDropOldest(t *testing.T) {
+	target := &memHandler{gate: make(chan struct{})}
+	queue := NewRecordQueue(2, OverflowDropOldest)
+	listener := NewQueueListener(queue, target).Start()
+	hdlr := NewQueueHandler(queue)
+
+	hdlr.Emit(newRecord("0"))
+	for queue.Len() > 0 {
+		runtime.Gosched()
+	}
+	for i := 1; i <= 5; i++ {
+		hdlr.Emit(newRecord(fmt.Sprint(i)))
+	}
+	assert.Equal(t, uint64(3), hdlr.Dropped())
+
+	close(target.gate)
+	assert.Nil(t, hdlr.Close())
+	assert.Equal(t, []string{"0", "4", "5"}, target.Messages())
+	listener.Stop()
+
+	// records put after close are dropped
+	hdlr.Emit(newRecord("6"))
+	assert.Equal(t, uint64(4), hdlr.Dropped())
+}
+
+func TestQueueHandlerCloseWithoutListener(t *testing.T) {
+	queue := NewRecordQueue(1, OverflowBlock)
+	hdlr := NewQueueHandler(queue)
+	hdlr.Emit(newRecord("0"))
+
+	// blocked by the full queue
+	put := make(chan bool)
+	go func() {
+		put <- queue.Put(newRecord("1"))
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		assert.Nil(t, hdlr.Flush())
+		assert.Nil(t, hdlr.Close())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close is blocked without listener")
+	}
+	assert.False(t, <-put)
+	assert.Equal(t, uint64(1), hdlr.Dropped())
+
+	// records left can be handled by a listener started later
+	target := &memHandler{}
+	NewQueueListener(queue, target).Start().Stop()
+	assert.Equal(t, []string{"0"}, target.Messages())
+}
+
+func TestGetOverflowPolicy(t *testing.T) {
+	for _, p := range []OverflowPolicy{OverflowBlock, OverflowDropNewest, OverflowDropOldest} {
+		got, err := GetOverflowPolicy(p.String())
+		assert.Nil(t, err)
+		assert.Equal(t, p, got)
+	}
+	_, err := GetOverflowPolicy("unknown")
+	assert.Error(t, err)
+}
+
+func TestQueueHandlerInterface(t *testing.T) {
+	assert.Implements(t, (*logdog.Handler)(nil), NewQueueHandler(NewRecordQueue(0, OverflowBlock)))
+}
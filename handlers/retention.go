@@ -0,0 +1,383 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zoumo/logdog/pkg/pythonic"
+	"github.com/zoumo/register"
+)
+
+const (
+	// tmpSuffix is appended to the compressed file until it is complete
+	tmpSuffix = ".tmp"
+	// stagingSuffix is appended to the closed file of RotatingFileHandler
+	// until it is shifted into backups in background
+	stagingSuffix = ".rotating"
+)
+
+var (
+	compressors = register.NewRegister(nil)
+)
+
+// Compressor wraps w into a compressing io.WriteCloser,
+// closing it must flush all compressed data to w
+type Compressor func(w io.Writer) (io.WriteCloser, error)
+
+type compressor struct {
+	ext      string
+	compress Compressor
+}
+
+// RegisterCompressor binds name, file extension and Compressor.
+// gzip is built in, zstd is registered by importing
+// github.com/zoumo/logdog/handlers/zstd
+func RegisterCompressor(name, ext string, c Compressor) {
+	compressors.Register(name, compressor{ext: ext, compress: c})
+}
+
+func getCompressor(name string) (compressor, bool) {
+	v, ok := compressors.Get(name)
+	if !ok {
+		return compressor{}, false
+	}
+	return v.(compressor), true
+}
+
+// compressedExts returns the extensions of all registered compressors
+func compressedExts() []string {
+	exts := []string{}
+	for _, v := range compressors.Values() {
+		exts = append(exts, v.(compressor).ext)
+	}
+	return exts
+}
+
+// trimCompressedExt removes the compressed extension from name
+func trimCompressedExt(name string) string {
+	for _, ext := range compressedExts() {
+		if strings.HasSuffix(name, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// RetentionPolicy compresses closed log segments and prunes
+// old backups for rotating file handlers.
+//
+// All work is done one job at a time in a background goroutine,
+// so it never blocks Emit. A compressed file is written to
+// a temporary file first and renamed when it is complete,
+// the source segment is removed after that.
+type RetentionPolicy struct {
+	// Compression is the name of a registered compressor, e.g. gzip.
+	// If it is empty, segments are not compressed
+	Compression string
+	// MaxAge is the maximum age of backups, zero means no limit
+	MaxAge time.Duration
+	// MaxTotalSize is the maximum total size in bytes of backups, zero means no limit
+	MaxTotalSize int64
+	// MaxFiles is the maximum number of backups, zero means no limit
+	MaxFiles int
+
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	pending []func()
+	running bool
+}
+
+// NewRetentionPolicy returns a RetentionPolicy compressing segments with gzip
+func NewRetentionPolicy() *RetentionPolicy {
+	return &RetentionPolicy{
+		Compression: "gzip",
+	}
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (p *RetentionPolicy) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	p.Compression = config.MustGetString("compression", "")
+	if p.Compression != "" {
+		if _, ok := getCompressor(p.Compression); !ok {
+			return fmt.Errorf("can not find compressor: %s", p.Compression)
+		}
+	}
+
+	maxAge := config.MustGetString("maxAge", "")
+	if maxAge != "" {
+		p.MaxAge, err = time.ParseDuration(maxAge)
+		if err != nil {
+			return err
+		}
+	}
+	p.MaxTotalSize = config.MustGetInt64("maxTotalSize", 0)
+	p.MaxFiles = config.MustGetInt("maxFiles", 0)
+
+	return nil
+}
+
+// loadRetention loads RetentionPolicy from the "retention" key of
+// handler's config, returns nil if it is not set
+func loadRetention(c map[string]interface{}) (*RetentionPolicy, error) {
+	conf, ok := c["retention"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	p := &RetentionPolicy{}
+	if err := p.LoadConfig(conf); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Schedule runs job in the background goroutine of the policy.
+// Jobs are run one by one in the order they are scheduled.
+func (p *RetentionPolicy) Schedule(job func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.wg.Add(1)
+	p.pending = append(p.pending, job)
+	if !p.running {
+		p.running = true
+		go p.run()
+	}
+}
+
+func (p *RetentionPolicy) run() {
+	for {
+		p.mu.Lock()
+		if len(p.pending) == 0 {
+			p.running = false
+			p.mu.Unlock()
+			return
+		}
+		job := p.pending[0]
+		p.pending = p.pending[1:]
+		p.mu.Unlock()
+
+		job()
+		p.wg.Done()
+	}
+}
+
+// Wait blocks until all scheduled jobs are done
+func (p *RetentionPolicy) Wait() {
+	p.wg.Wait()
+}
+
+// Process schedules the closed segment to be compressed,
+// then prunes the backups returned by list
+func (p *RetentionPolicy) Process(segment string, list func() []string) {
+	p.Schedule(func() {
+		p.compressAndPrune(segment, list)
+	})
+}
+
+func (p *RetentionPolicy) compressAndPrune(segment string, list func() []string) {
+	if _, err := p.Compress(segment); err != nil {
+		fmt.Fprintf(os.Stderr, "Compress file %s failed, [%v]\n", segment, err)
+	}
+	if err := p.Prune(list()); err != nil {
+		fmt.Fprintf(os.Stderr, "Prune backups failed, [%v]\n", err)
+	}
+}
+
+// Recover schedules a job to finish the work interrupted by a crash,
+// backups returned by list which are not compressed yet are compressed,
+// then all backups are pruned
+func (p *RetentionPolicy) Recover(list func() []string) {
+	p.Schedule(func() {
+		if p.Compression != "" {
+			for _, backup := range list() {
+				if trimCompressedExt(backup) != backup {
+					continue
+				}
+				if _, err := p.Compress(backup); err != nil {
+					fmt.Fprintf(os.Stderr, "Compress file %s failed, [%v]\n", backup, err)
+				}
+			}
+		}
+		if err := p.Prune(list()); err != nil {
+			fmt.Fprintf(os.Stderr, "Prune backups failed, [%v]\n", err)
+		}
+	})
+}
+
+// removeStaleFiles removes files left by a crash in Compress
+// next to the log file located in path: temporary compressed files,
+// and source files whose compressed file is complete
+func removeStaleFiles(path string) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	prefix := base + "."
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		name = filepath.Join(dir, name)
+		if strings.HasSuffix(name, tmpSuffix) {
+			os.Remove(name)
+			continue
+		}
+		// the compressed file is renamed from the temporary one
+		// only when it is complete
+		if src := trimCompressedExt(name); src != name && src != filepath.Join(dir, base) {
+			os.Remove(src)
+		}
+	}
+}
+
+// Compress compresses the file located in path and removes it,
+// returns the path of compressed file.
+// If Compression is empty, path is returned unchanged.
+func (p *RetentionPolicy) Compress(path string) (string, error) {
+	if p.Compression == "" {
+		return path, nil
+	}
+
+	c, ok := getCompressor(p.Compression)
+	if !ok {
+		return path, fmt.Errorf("can not find compressor: %s", p.Compression)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return path, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return path, err
+	}
+
+	dst := path + c.ext
+	tmp := dst + tmpSuffix
+
+	if err := compressFile(c.compress, src, tmp); err != nil {
+		os.Remove(tmp)
+		return path, err
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return path, err
+	}
+	// keep the modification time of segment, it is used to prune by age
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	return dst, os.Remove(path)
+}
+
+func compressFile(compress Compressor, src io.Reader, tmp string) error {
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w, err := compress(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// make sure the data is on disk before it is renamed
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Prune removes backups exceeding MaxAge, MaxTotalSize or MaxFiles,
+// the newest backups are kept
+func (p *RetentionPolicy) Prune(backups []string) error {
+	if p.MaxAge <= 0 && p.MaxTotalSize <= 0 && p.MaxFiles <= 0 {
+		return nil
+	}
+
+	infos := make([]os.FileInfo, 0, len(backups))
+	paths := make(map[os.FileInfo]string, len(backups))
+	for _, backup := range backups {
+		info, err := os.Stat(backup)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+		paths[info] = backup
+	}
+
+	// newest first
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+
+	var (
+		firstErr error
+		total    int64
+		cutoff   = time.Now().Add(-p.MaxAge)
+	)
+	for i, info := range infos {
+		total += info.Size()
+		expired := (p.MaxFiles > 0 && i >= p.MaxFiles) ||
+			(p.MaxTotalSize > 0 && total > p.MaxTotalSize) ||
+			(p.MaxAge > 0 && info.ModTime().Before(cutoff))
+		if !expired {
+			continue
+		}
+		if err := os.Remove(paths[info]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func init() {
+	RegisterCompressor("gzip", ".gz", func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	})
+}
@@ -0,0 +1,272 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+)
+
+func readGzip(t *testing.T, path string) string {
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	r, err := gzip.NewReader(file)
+	assert.Nil(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func listDir(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRetentionPolicyCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log.1")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\n"), 0660))
+	// a stale temporary file left by a crash
+	assert.Nil(t, ioutil.WriteFile(path+".gz.tmp", []byte("broken"), 0660))
+
+	p := NewRetentionPolicy()
+	dst, err := p.Compress(path)
+	assert.Nil(t, err)
+	assert.Equal(t, path+".gz", dst)
+	assert.Equal(t, "hello\n", readGzip(t, dst))
+	assert.Equal(t, []string{"app.log.1.gz"}, listDir(t, dir))
+
+	p.Compression = "unknown"
+	path = filepath.Join(dir, "app.log.2")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\n"), 0660))
+	dst, err = p.Compress(path)
+	assert.Error(t, err)
+	assert.Equal(t, path, dst)
+	assert.Equal(t, []string{"app.log.1.gz", "app.log.2"}, listDir(t, dir))
+}
+
+func TestRetentionPolicyPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	backups := []string{}
+	for i := 1; i <= 5; i++ {
+		path := filepath.Join(dir, "app.log."+string(rune('0'+i)))
+		assert.Nil(t, ioutil.WriteFile(path, []byte("0123456789"), 0660))
+		mtime := now.Add(-time.Duration(i) * time.Hour)
+		assert.Nil(t, os.Chtimes(path, mtime, mtime))
+		backups = append(backups, path)
+	}
+
+	p := &RetentionPolicy{MaxFiles: 4}
+	assert.Nil(t, p.Prune(backups))
+	assert.Equal(t, []string{"app.log.1", "app.log.2", "app.log.3", "app.log.4"}, listDir(t, dir))
+
+	p = &RetentionPolicy{MaxTotalSize: 35}
+	assert.Nil(t, p.Prune(backups))
+	assert.Equal(t, []string{"app.log.1", "app.log.2", "app.log.3"}, listDir(t, dir))
+
+	p = &RetentionPolicy{MaxAge: 90 * time.Minute}
+	assert.Nil(t, p.Prune(backups))
+	assert.Equal(t, []string{"app.log.1"}, listDir(t, dir))
+}
+
+func TestRetentionPolicySchedule(t *testing.T) {
+	p := &RetentionPolicy{}
+	result := []int{}
+	for i := 0; i < 100; i++ {
+		i := i
+		p.Schedule(func() {
+			result = append(result, i)
+		})
+	}
+	p.Wait()
+	assert.Len(t, result, 100)
+	assert.True(t, sort.IntsAreSorted(result))
+}
+
+func TestRotatingFileHandlerCompression(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	hdlr := NewRotatingFileHandler(&logdog.TextFormatter{Fmt: "%(message)"})
+	hdlr.MaxLine = 1
+	hdlr.BackupCount = 3
+	hdlr.Retention = &RetentionPolicy{Compression: "gzip", MaxFiles: 2}
+	hdlr.SetPath(path)
+
+	for _, msg := range []string{"1", "2", "3", "4"} {
+		hdlr.Emit(newRecord(msg))
+	}
+	assert.Nil(t, hdlr.Close())
+
+	assert.Equal(t, []string{"app.log", "app.log.1.gz", "app.log.2.gz"}, listDir(t, dir))
+	assert.Equal(t, []string{"4"}, readLines(t, path))
+	assert.Equal(t, "3\n", readGzip(t, path+".1.gz"))
+	assert.Equal(t, "2\n", readGzip(t, path+".2.gz"))
+}
+
+func TestTimedRotatingFileHandlerCompression(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	for _, name := range []string{"app.log.2016-10-29.gz", "app.log.2016-10-30.gz", "app.log.2016-10-30.gz.tmp"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0660))
+	}
+
+	hdlr := NewTimedRotatingFileHandler(&logdog.TextFormatter{Fmt: "%(message)"})
+	hdlr.BackupCount = 2
+	hdlr.UTC = true
+	hdlr.Retention = NewRetentionPolicy()
+	hdlr.FileHandler.SetPath(path)
+
+	hdlr.Emit(newRecord("first"))
+	hdlr.RolloverAt = time.Date(2016, 11, 1, 0, 0, 0, 0, time.UTC)
+	hdlr.Emit(newRecord("second"))
+	assert.Nil(t, hdlr.Close())
+
+	assert.Equal(t, []string{"app.log", "app.log.2016-10-30.gz", "app.log.2016-10-30.gz.tmp", "app.log.2016-10-31.gz"}, listDir(t, dir))
+	assert.Equal(t, "first\n", readGzip(t, path+".2016-10-31.gz"))
+}
+
+func writeGzip(t *testing.T, path, content string) {
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	w := gzip.NewWriter(file)
+	_, err = w.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+}
+
+// setAges sets the modification time of files to now minus their hours
+func setAges(t *testing.T, ages map[string]int) {
+	now := time.Now()
+	for path, hours := range ages {
+		mtime := now.Add(-time.Duration(hours) * time.Hour)
+		assert.Nil(t, os.Chtimes(path, mtime, mtime))
+	}
+}
+
+func TestRotatingFileHandlerRecover(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("current\n"), 0660))
+	// crashed after the file was moved aside, before it was rotated
+	assert.Nil(t, ioutil.WriteFile(path+".200.rotating", []byte("b\n"), 0660))
+	assert.Nil(t, ioutil.WriteFile(path+".100.rotating", []byte("a\n"), 0660))
+	// crashed in compression
+	assert.Nil(t, ioutil.WriteFile(path+".1", []byte("x\n"), 0660))
+	assert.Nil(t, ioutil.WriteFile(path+".1.gz.tmp", []byte("broken"), 0660))
+	// crashed between the rename of the compressed file and the removal of its source
+	assert.Nil(t, ioutil.WriteFile(path+".2", []byte("y\n"), 0660))
+	writeGzip(t, path+".2.gz", "y\n")
+	setAges(t, map[string]int{path + ".200.rotating": 1, path + ".100.rotating": 2, path + ".1": 3, path + ".2.gz": 4})
+
+	hdlr := NewRotatingFileHandler(&logdog.TextFormatter{Fmt: "%(message)"})
+	hdlr.BackupCount = 5
+	hdlr.Retention = &RetentionPolicy{Compression: "gzip", MaxFiles: 3}
+	hdlr.SetPath(path)
+	assert.Nil(t, hdlr.Close())
+
+	assert.Equal(t, []string{"app.log", "app.log.1.gz", "app.log.2.gz", "app.log.3.gz"}, listDir(t, dir))
+	assert.Equal(t, []string{"current"}, readLines(t, path))
+	assert.Equal(t, "b\n", readGzip(t, path+".1.gz"))
+	assert.Equal(t, "a\n", readGzip(t, path+".2.gz"))
+	assert.Equal(t, "x\n", readGzip(t, path+".3.gz"))
+}
+
+func TestRotatingFileHandlerRecoverWithoutRetention(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	assert.Nil(t, ioutil.WriteFile(path+".100.rotating", []byte("a\n"), 0660))
+	assert.Nil(t, ioutil.WriteFile(path+".1.gz.tmp", []byte("broken"), 0660))
+
+	hdlr := NewRotatingFileHandler()
+	hdlr.BackupCount = 2
+	hdlr.SetPath(path)
+	assert.Nil(t, hdlr.Close())
+
+	assert.Equal(t, []string{"app.log", "app.log.1"}, listDir(t, dir))
+	assert.Equal(t, []string{"a"}, readLines(t, path+".1"))
+}
+
+func TestTimedRotatingFileHandlerRecover(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	// crashed after rename, before compression
+	assert.Nil(t, ioutil.WriteFile(path+".2016-10-29", []byte("a\n"), 0660))
+	// crashed in compression
+	assert.Nil(t, ioutil.WriteFile(path+".2016-10-30", []byte("b\n"), 0660))
+	assert.Nil(t, ioutil.WriteFile(path+".2016-10-30.gz.tmp", []byte("broken"), 0660))
+	// crashed between the rename of the compressed file and the removal of its source
+	assert.Nil(t, ioutil.WriteFile(path+".2016-10-31", []byte("c\n"), 0660))
+	writeGzip(t, path+".2016-10-31.gz", "c\n")
+	setAges(t, map[string]int{path + ".2016-10-29": 3, path + ".2016-10-30": 2, path + ".2016-10-31.gz": 1})
+
+	hdlr := NewTimedRotatingFileHandler()
+	hdlr.UTC = true
+	hdlr.Retention = &RetentionPolicy{Compression: "gzip", MaxFiles: 2}
+	hdlr.SetPath(path)
+	assert.Nil(t, hdlr.Close())
+
+	assert.Equal(t, []string{"app.log", "app.log.2016-10-30.gz", "app.log.2016-10-31.gz"}, listDir(t, dir))
+	assert.Equal(t, "b\n", readGzip(t, path+".2016-10-30.gz"))
+	assert.Equal(t, "c\n", readGzip(t, path+".2016-10-31.gz"))
+}
+
+func TestRetentionLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	hdlr := NewRotatingFileHandler()
+	err := hdlr.LoadConfig(logdog.Config{
+		"filename": path,
+		"retention": map[string]interface{}{
+			"compression":  "gzip",
+			"maxAge":       "168h",
+			"maxTotalSize": 1024.0,
+			"maxFiles":     10.0,
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "gzip", hdlr.Retention.Compression)
+	assert.Equal(t, 168*time.Hour, hdlr.Retention.MaxAge)
+	assert.Equal(t, int64(1024), hdlr.Retention.MaxTotalSize)
+	assert.Equal(t, 10, hdlr.Retention.MaxFiles)
+	assert.Nil(t, hdlr.Close())
+
+	timed := NewTimedRotatingFileHandler()
+	err = timed.LoadConfig(logdog.Config{
+		"filename": path,
+		"retention": map[string]interface{}{
+			"compression": "zstd",
+		},
+	})
+	assert.Error(t, err)
+	assert.Nil(t, timed.Close())
+}
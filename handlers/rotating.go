@@ -11,16 +11,38 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
+
 package handler
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/zoumo/logdog"
+	"github.com/zoumo/logdog/pkg/pythonic"
 )
 
+// RotatingFileHandler is a FileHandler which switches from one file
+// to the next when the current file reaches a certain size or line count.
+//
+// When rollover happens, app.log is renamed to app.log.1, app.log.1 to
+// app.log.2 and so on, up to app.log.BackupCount, and a new app.log is
+// opened. If either BackupCount is zero or both MaxSize and MaxLine are
+// zero, rollover never occurs.
+//
+// If Retention is set, the closed file is moved aside to a temporary
+// app.log.<timestamp>.rotating file, then shifted, compressed and pruned
+// in background. Files left by a crash in the middle of this are
+// picked up when the file is opened by SetPath or LoadConfig.
 type RotatingFileHandler struct {
 	logdog.FileHandler
 
@@ -30,21 +52,303 @@ type RotatingFileHandler struct {
 	MaxSize int
 	CurSize int
 
-	Daily bool
+	BackupCount int
+
+	Retention *RetentionPolicy
+
+	mu sync.Mutex
 }
 
-func NewRotatingFileHandler(name string, path string) {
+// NewRotatingFileHandler returns a new RotatingFileHandler fully initialized
+func NewRotatingFileHandler(options ...logdog.Option) *RotatingFileHandler {
+	hdlr := &RotatingFileHandler{
+		FileHandler: logdog.FileHandler{
+			Output:    logdog.Discard,
+			Level:     logdog.NothingLevel,
+			Formatter: logdog.DefaultFormatter,
+		},
+	}
+
+	hdlr.ApplyOptions(options...)
 
+	return hdlr
 }
 
-func (hdlr RotatingFileHandler) shouldRollover(size int) bool {
-	needed := (hdlr.MaxSize > 0 && (hdlr.CurSize+size) >= hdlr.MaxSize) ||
-		(hdlr.MaxLine > 0 && (hdlr.CurLine+1) >= hdlr.MaxLine)
+// ApplyOptions applys all option to RotatingFileHandler
+func (hdlr *RotatingFileHandler) ApplyOptions(options ...logdog.Option) *RotatingFileHandler {
+	hdlr.FileHandler.ApplyOptions(options...)
+	return hdlr
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (hdlr *RotatingFileHandler) LoadConfig(c map[string]interface{}) error {
+	if err := hdlr.FileHandler.LoadConfig(c); err != nil {
+		return err
+	}
+
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	hdlr.MaxSize = config.MustGetInt("maxSize", 0)
+	hdlr.MaxLine = config.MustGetInt("maxLine", 0)
+	hdlr.BackupCount = config.MustGetInt("backupCount", 0)
+
+	hdlr.Retention, err = loadRetention(c)
+	if err != nil {
+		return err
+	}
+
+	if err := hdlr.loadStat(); err != nil {
+		return err
+	}
+	hdlr.recoverFiles()
+	return nil
+}
+
+// SetPath opens file located in the path, if not, create it.
+// The current size and line count of the file are picked up,
+// so that an existing file continues to grow towards its limits.
+func (hdlr *RotatingFileHandler) SetPath(path string) *RotatingFileHandler {
+	hdlr.FileHandler.SetPath(path)
+	if err := hdlr.loadStat(); err != nil {
+		panic(fmt.Sprintf("Can not stat file %s, [%v]", path, err))
+	}
+	hdlr.recoverFiles()
+	return hdlr
+}
+
+// Emit log record to file, rollover the file before
+// the record is written if necessary
+func (hdlr *RotatingFileHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Output == nil || hdlr.Formatter == nil {
+		panic("you should set output and fomatter before use this handler")
+	}
+
+	if hdlr.Filter(record) {
+		return
+	}
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	msg, err := hdlr.Formatter.Format(record)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Format record failed, [%v]\n", err)
+		return
+	}
+
+	if hdlr.shouldRollover(len(msg) + 1) {
+		if err := hdlr.doRollover(); err != nil {
+			fmt.Fprintf(os.Stderr, "Rollover file %s failed, [%v]\n", hdlr.Path, err)
+		}
+	}
+
+	n, _ := fmt.Fprintln(hdlr.Output, msg)
+	hdlr.CurSize += n
+	hdlr.CurLine++
+}
+
+// shouldRollover checks if writing size bytes more would make the
+// current file exceed MaxSize or MaxLine.
+// An empty file never rolls over, even if the record itself is
+// larger than MaxSize.
+func (hdlr *RotatingFileHandler) shouldRollover(size int) bool {
+	if hdlr.BackupCount <= 0 || (hdlr.CurSize == 0 && hdlr.CurLine == 0) {
+		return false
+	}
+	needed := (hdlr.MaxSize > 0 && (hdlr.CurSize+size) > hdlr.MaxSize) ||
+		(hdlr.MaxLine > 0 && (hdlr.CurLine+1) > hdlr.MaxLine)
 	return needed
 }
 
-func (hdlr RotatingFileHandler) doRollover() {
+// doRollover closes the current file, shifts the backups
+// and reopens the file located in Path
+func (hdlr *RotatingFileHandler) doRollover() error {
+	if hdlr.Output != nil {
+		hdlr.Output.Close()
+	}
+
+	var renameErr error
+	if hdlr.Retention == nil {
+		renameErr = hdlr.rotate(hdlr.Path)
+	} else {
+		// move the file aside, shifting and compressing
+		// are done in background
+		segment := fmt.Sprintf("%s.%d%s", hdlr.Path, time.Now().UnixNano(), stagingSuffix)
+		renameErr = os.Rename(hdlr.Path, segment)
+		if renameErr == nil {
+			hdlr.scheduleRotate(segment)
+		}
+	}
+
+	// reopen the file even if rename failed, otherwise
+	// all records after this would be lost
+	file, err := os.OpenFile(hdlr.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		hdlr.Output = logdog.Discard
+		return err
+	}
+	hdlr.Output = file
+
+	// reset the counters even if rename failed, so that the next
+	// rollover is tried after another MaxSize or MaxLine instead
+	// of on every record
+	hdlr.CurSize = 0
+	hdlr.CurLine = 0
 
+	return renameErr
+}
+
+// scheduleRotate shifts the staged segment into backups,
+// compresses and prunes them in background
+func (hdlr *RotatingFileHandler) scheduleRotate(segment string) {
+	hdlr.Retention.Schedule(func() {
+		if err := hdlr.rotate(segment); err != nil {
+			fmt.Fprintf(os.Stderr, "Rotate file %s failed, [%v]\n", segment, err)
+			return
+		}
+		hdlr.Retention.compressAndPrune(hdlr.Path+".1", hdlr.backups)
+	})
+}
+
+// recoverFiles finishes the work left by a crash when the file is opened.
+// Stale files of compression are removed, staged segments are
+// shifted into backups from the oldest one, and backups are
+// compressed and pruned by Retention.
+func (hdlr *RotatingFileHandler) recoverFiles() {
+	if hdlr.Path == "" {
+		return
+	}
+	if hdlr.Retention != nil {
+		// do not race with jobs of the file opened before
+		hdlr.Retention.Wait()
+	}
+
+	removeStaleFiles(hdlr.Path)
+
+	for _, segment := range hdlr.stagedSegments() {
+		if hdlr.Retention != nil {
+			hdlr.scheduleRotate(segment)
+		} else if err := hdlr.rotate(segment); err != nil {
+			fmt.Fprintf(os.Stderr, "Rotate file %s failed, [%v]\n", segment, err)
+		}
+	}
+
+	if hdlr.Retention != nil {
+		hdlr.Retention.Recover(hdlr.backups)
+	}
+}
+
+// stagedSegments returns the segments moved aside by doRollover
+// which are not shifted into backups, the oldest first
+func (hdlr *RotatingFileHandler) stagedSegments() []string {
+	dir, base := filepath.Split(hdlr.Path)
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	prefix := base + "."
+	stamps := map[string]int64{}
+	segments := []string{}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, stagingSuffix) {
+			continue
+		}
+		stamp, err := strconv.ParseInt(strings.TrimSuffix(name[len(prefix):], stagingSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segment := filepath.Join(dir, name)
+		stamps[segment] = stamp
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return stamps[segments[i]] < stamps[segments[j]]
+	})
+	return segments
+}
+
+// rotate shifts the backups, both plain and compressed ones,
+// and moves segment to the first backup
+func (hdlr *RotatingFileHandler) rotate(segment string) error {
+	exts := append([]string{""}, compressedExts()...)
+
+	var firstErr error
+	move := func(sfn, dfn string) {
+		for _, ext := range exts {
+			os.Remove(dfn + ext)
+		}
+		for _, ext := range exts {
+			if _, err := os.Stat(sfn + ext); err != nil {
+				continue
+			}
+			if err := os.Rename(sfn+ext, dfn+ext); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	for i := hdlr.BackupCount - 1; i > 0; i-- {
+		move(fmt.Sprintf("%s.%d", hdlr.Path, i), fmt.Sprintf("%s.%d", hdlr.Path, i+1))
+	}
+
+	dfn := hdlr.Path + ".1"
+	for _, ext := range exts {
+		os.Remove(dfn + ext)
+	}
+	if err := os.Rename(segment, dfn); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
+
+// backups returns all existing backups
+func (hdlr *RotatingFileHandler) backups() []string {
+	exts := append([]string{""}, compressedExts()...)
+	result := []string{}
+	for i := 1; i <= hdlr.BackupCount; i++ {
+		for _, ext := range exts {
+			name := fmt.Sprintf("%s.%d%s", hdlr.Path, i, ext)
+			if _, err := os.Stat(name); err == nil {
+				result = append(result, name)
+			}
+		}
+	}
+	return result
+}
+
+// Close waits for background compression and closes the file
+func (hdlr *RotatingFileHandler) Close() error {
+	if hdlr.Retention != nil {
+		hdlr.Retention.Wait()
+	}
+	return hdlr.FileHandler.Close()
+}
+
+// loadStat picks up the current size and line count of the file
+func (hdlr *RotatingFileHandler) loadStat() error {
+	info, err := os.Stat(hdlr.Path)
+	if err != nil {
+		return err
+	}
+	hdlr.CurSize = int(info.Size())
+
+	lines, err := hdlr.countLine()
+	if err != nil {
+		return err
+	}
+	hdlr.CurLine = lines
+
+	return nil
 }
 
 // Here is a faster line counter useing bytes.Count
@@ -53,7 +357,7 @@ func (hdlr RotatingFileHandler) doRollover() {
 // BenchmarkBuffioScan   500      6408963 ns/op     4208 B/op    2 allocs/op
 // BenchmarkBytesCount   500      4323397 ns/op     8200 B/op    1 allocs/op
 // BenchmarkBytes32k     500      3650818 ns/op     65545 B/op   1 allocs/op
-func (hdlr RotatingFileHandler) countLine() (int, error) {
+func (hdlr *RotatingFileHandler) countLine() (int, error) {
 	file, err := os.Open(hdlr.Path)
 	if err != nil {
 		return 0, err
@@ -79,3 +383,9 @@ func (hdlr RotatingFileHandler) countLine() (int, error) {
 
 	return count, nil
 }
+
+func init() {
+	logdog.RegisterConstructor("RotatingFileHandler", func() logdog.ConfigLoader {
+		return NewRotatingFileHandler()
+	})
+}
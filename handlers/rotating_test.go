@@ -0,0 +1,161 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+)
+
+func newRecord(msg string) *logdog.LogRecord {
+	return logdog.NewLogRecord("test", logdog.InfoLevel, "test/record", "test/test.record", 1, msg)
+}
+
+func readLines(t *testing.T, path string) []string {
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	content := strings.TrimRight(string(data), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+func TestRotatingFileHandlerMaxLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	hdlr := NewRotatingFileHandler(logdog.NewJSONFormatter())
+	hdlr.MaxLine = 2
+	hdlr.BackupCount = 2
+	hdlr.SetPath(path)
+	defer hdlr.Close()
+
+	for i := 0; i < 7; i++ {
+		hdlr.Emit(newRecord("line"))
+	}
+
+	assert.Len(t, readLines(t, path), 1)
+	assert.Len(t, readLines(t, path+".1"), 2)
+	assert.Len(t, readLines(t, path+".2"), 2)
+	_, err := os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRotatingFileHandlerMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	hdlr := NewRotatingFileHandler(&logdog.TextFormatter{Fmt: "%(message)"})
+	hdlr.MaxSize = 10
+	hdlr.BackupCount = 1
+	hdlr.SetPath(path)
+	defer hdlr.Close()
+
+	hdlr.Emit(newRecord("1234"))
+	hdlr.Emit(newRecord("5678"))
+	hdlr.Emit(newRecord("abcd"))
+
+	assert.Equal(t, []string{"abcd"}, readLines(t, path))
+	assert.Equal(t, []string{"1234", "5678"}, readLines(t, path+".1"))
+	assert.Equal(t, 5, hdlr.CurSize)
+}
+
+func TestRotatingFileHandlerRenameFailed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	// app.log can not be renamed to a non-empty directory
+	assert.Nil(t, os.MkdirAll(filepath.Join(path+".1", "x"), 0770))
+
+	hdlr := NewRotatingFileHandler(&logdog.TextFormatter{Fmt: "%(message)"})
+	hdlr.MaxLine = 2
+	hdlr.BackupCount = 1
+	hdlr.SetPath(path)
+	defer hdlr.Close()
+
+	hdlr.Emit(newRecord("1"))
+	hdlr.Emit(newRecord("2"))
+	hdlr.Emit(newRecord("3")) // rollover failed
+	assert.Equal(t, 1, hdlr.CurLine)
+	assert.False(t, hdlr.shouldRollover(2), "no retry before MaxLine is reached again")
+
+	hdlr.Emit(newRecord("4"))
+	assert.Equal(t, []string{"1", "2", "3", "4"}, readLines(t, path))
+	assert.True(t, hdlr.shouldRollover(2))
+}
+
+func TestRotatingFileHandlerPickUpExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("a\nb\nc\n"), 0660))
+
+	hdlr := NewRotatingFileHandler()
+	hdlr.SetPath(path)
+	defer hdlr.Close()
+
+	assert.Equal(t, 3, hdlr.CurLine)
+	assert.Equal(t, 6, hdlr.CurSize)
+}
+
+func TestRotatingFileHandlerNoBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	hdlr := NewRotatingFileHandler()
+	hdlr.MaxLine = 1
+	hdlr.SetPath(path)
+	defer hdlr.Close()
+
+	hdlr.Emit(newRecord("1"))
+	hdlr.Emit(newRecord("2"))
+
+	assert.Len(t, readLines(t, path), 2)
+	_, err := os.Stat(path + ".1")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRotatingFileHandlerLoadJSONConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	config := []byte(`{
+        "handlers": {
+            "rotating": {
+                "class": "RotatingFileHandler",
+                "filename": "` + path + `",
+                "maxSize": 1024,
+                "maxLine": 100,
+                "backupCount": 3
+            }
+        }
+    }`)
+
+	err := logdog.LoadJSONConfig(config)
+	assert.Nil(t, err)
+
+	hdlr, ok := logdog.GetHandler("rotating").(*RotatingFileHandler)
+	assert.True(t, ok)
+	assert.Equal(t, path, hdlr.Path)
+	assert.Equal(t, 1024, hdlr.MaxSize)
+	assert.Equal(t, 100, hdlr.MaxLine)
+	assert.Equal(t, 3, hdlr.BackupCount)
+	assert.Nil(t, hdlr.Close())
+}
+
+func TestRotatingFileHandlerInterface(t *testing.T) {
+	assert.Implements(t, (*logdog.Handler)(nil), NewRotatingFileHandler())
+	assert.Implements(t, (*logdog.ConfigLoader)(nil), NewRotatingFileHandler())
+}
@@ -0,0 +1,617 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zoumo/logdog"
+	"github.com/zoumo/logdog/pkg/pythonic"
+)
+
+const (
+	// DefaultSocketTimeout is the default timeout of dialing and writing
+	DefaultSocketTimeout = 5 * time.Second
+
+	// maxRecordSize is the maximum size of an encoded record
+	// accepted by SocketReceiver
+	maxRecordSize = 16 << 20
+)
+
+// wireRecord is the encoding of LogRecord sent over network,
+// the message is formatted by sender
+type wireRecord struct {
+	Name          string        `json:"name"`
+	Level         logdog.Level  `json:"level"`
+	LevelName     string        `json:"levelname"`
+	PathName      string        `json:"pathname"`
+	FileName      string        `json:"filename"`
+	FuncName      string        `json:"funcname"`
+	ShortFuncName string        `json:"shortfuncname"`
+	Module        string        `json:"module"`
+	Package       string        `json:"package"`
+	Line          int           `json:"lineno"`
+	Time          time.Time     `json:"time"`
+	Message       string        `json:"message"`
+	Fields        logdog.Fields `json:"fields,omitempty"`
+	Stack         string        `json:"stack,omitempty"`
+	Process       int           `json:"process"`
+	ProcessName   string        `json:"processName"`
+	Hostname      string        `json:"hostname"`
+	Goroutine     int           `json:"goroutine,omitempty"`
+}
+
+// encodeRecord encodes record to JSON, field values which can not
+// be encoded are converted to string
+func encodeRecord(record *logdog.LogRecord) ([]byte, error) {
+	wr := wireRecord{
+		Name:          record.Name,
+		Level:         record.Level,
+		LevelName:     record.LevelName,
+		PathName:      record.PathName,
+		FileName:      record.FileName,
+		FuncName:      record.FuncName,
+		ShortFuncName: record.ShortFuncName,
+		Module:        record.Module,
+		Package:       record.Package,
+		Line:          record.Line,
+		Time:          record.Time,
+		Message:       record.GetMessage(),
+		Stack:         record.Stack,
+		Process:       record.Process,
+		ProcessName:   record.ProcessName,
+		Hostname:      record.Hostname,
+		Goroutine:     record.Goroutine,
+	}
+
+	if fields := record.AllFields(); len(fields) > 0 {
+		wr.Fields = make(logdog.Fields, len(fields))
+		for k, v := range fields {
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			wr.Fields[k] = v
+		}
+	}
+
+	data, err := json.Marshal(wr)
+	if err == nil {
+		return data, nil
+	}
+
+	for k, v := range wr.Fields {
+		wr.Fields[k] = fmt.Sprintf("%+v", v)
+	}
+	return json.Marshal(wr)
+}
+
+// decodeRecord decodes a LogRecord encoded by encodeRecord
+func decodeRecord(data []byte) (*logdog.LogRecord, error) {
+	wr := wireRecord{}
+	if err := json.Unmarshal(data, &wr); err != nil {
+		return nil, err
+	}
+	return &logdog.LogRecord{
+		Name:          wr.Name,
+		Level:         wr.Level,
+		LevelName:     wr.LevelName,
+		PathName:      wr.PathName,
+		FileName:      wr.FileName,
+		FuncName:      wr.FuncName,
+		ShortFuncName: wr.ShortFuncName,
+		Module:        wr.Module,
+		Package:       wr.Package,
+		Line:          wr.Line,
+		Time:          wr.Time,
+		// the message is formatted, keep it away from Sprintf
+		Args:   []interface{}{wr.Message},
+		Fields: wr.Fields,
+		Stack:  wr.Stack,
+
+		Process:     wr.Process,
+		ProcessName: wr.ProcessName,
+		Hostname:    wr.Hostname,
+		Goroutine:   wr.Goroutine,
+	}, nil
+}
+
+// isStream checks if network is a stream-oriented network
+func isStream(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	}
+	return true
+}
+
+// SocketHandler is a handler which sends records to a SocketReceiver
+// over TCP, UDP or unix socket.
+//
+// Records are encoded as JSON. On stream networks, each record is
+// prefixed with its 4-byte big-endian length, on datagram networks,
+// each record is sent in a datagram.
+//
+// Emit never dials, the connection is established in a goroutine. Until
+// it is up, records are kept in Spool, and the goroutine retries with
+// exponential backoff from MinBackoff to MaxBackoff. Once connected,
+// records in Spool are sent first. Records are dropped only if Spool
+// is full. Writes time out after Timeout, and the connection is treated
+// as lost then.
+type SocketHandler struct {
+	Name  string
+	Level logdog.Level
+
+	Network    string
+	Address    string
+	Timeout    time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Spool      Spool
+	logdog.Filterer
+
+	conn    net.Conn
+	stream  bool
+	backoff backoff
+	dropped uint64
+	mu      sync.Mutex
+
+	// dialing is true if the goroutine connecting is running
+	dialing bool
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewSocketHandler returns a new SocketHandler sending records to
+// address on network, it spools up to DefaultSpoolSize bytes in memory.
+// The connection is established in background when the first record
+// is emitted.
+func NewSocketHandler(network, address string, options ...logdog.Option) *SocketHandler {
+	hdlr := &SocketHandler{
+		Name:       "",
+		Level:      logdog.NothingLevel,
+		Network:    network,
+		Address:    address,
+		Timeout:    DefaultSocketTimeout,
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		Spool:      NewMemorySpool(DefaultSpoolSize),
+	}
+
+	hdlr.ApplyOptions(options...)
+
+	return hdlr
+}
+
+// ApplyOptions applys all option to SocketHandler
+func (hdlr *SocketHandler) ApplyOptions(options ...logdog.Option) *SocketHandler {
+	logdog.ApplyOptionsTo(hdlr, options...)
+	return hdlr
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (hdlr *SocketHandler) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	hdlr.Name = config.MustGetString("name", "")
+	hdlr.Level = logdog.GetLevel(config.MustGetString("level", "NOTHING"))
+	hdlr.Network = config.MustGetString("network", "tcp")
+	hdlr.Address = config.MustGetString("address", "")
+
+	for key, d := range map[string]*time.Duration{
+		"timeout":    &hdlr.Timeout,
+		"minBackoff": &hdlr.MinBackoff,
+		"maxBackoff": &hdlr.MaxBackoff,
+	} {
+		if v := config.MustGetString(key, ""); v != "" {
+			if *d, err = time.ParseDuration(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if conf, ok := c["spool"].(map[string]interface{}); ok {
+		spool, err := pythonic.DictReflect(conf)
+		if err != nil {
+			return err
+		}
+		maxSize := spool.MustGetInt64("maxSize", DefaultSpoolSize)
+		if path := spool.MustGetString("path", ""); path != "" {
+			if hdlr.Spool, err = NewFileSpool(path, maxSize); err != nil {
+				return err
+			}
+		} else {
+			hdlr.Spool = NewMemorySpool(maxSize)
+		}
+	}
+
+	filters, err := logdog.LoadFilters(c)
+	if err != nil {
+		return err
+	}
+	hdlr.AddFilters(filters...)
+	if hdlr.LevelMask, err = logdog.LoadLevelMask(c); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Emit sends log record to the peer, or keeps it in Spool
+// if the peer is down
+func (hdlr *SocketHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Filter(record) {
+		return
+	}
+
+	data, err := encodeRecord(record)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Encode record failed, [%v]\n", err)
+		return
+	}
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	// keep records in order, the spool must be drained first
+	if hdlr.conn != nil && hdlr.drain() == nil && hdlr.send(data) == nil {
+		return
+	}
+	if !hdlr.Spool.Push(data) {
+		atomic.AddUint64(&hdlr.dropped, 1)
+	}
+	hdlr.reconnect()
+}
+
+// Enabled checks if handler takes records at level
+func (hdlr *SocketHandler) Enabled(level logdog.Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level)
+}
+
+// Filter checks if handler should filter the specified record
+func (hdlr *SocketHandler) Filter(record *logdog.LogRecord) bool {
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
+}
+
+// Dropped returns the number of records dropped because Spool is full
+func (hdlr *SocketHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&hdlr.dropped)
+}
+
+// Flush sends all records in Spool, it fails if the connection is down
+func (hdlr *SocketHandler) Flush() error {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	if err := hdlr.drain(); err != nil {
+		hdlr.reconnect()
+		return err
+	}
+	return nil
+}
+
+// Close stops reconnecting and tries to send all records in Spool,
+// then closes the connection and Spool
+func (hdlr *SocketHandler) Close() error {
+	hdlr.mu.Lock()
+	if !hdlr.closed {
+		hdlr.closed = true
+		if hdlr.done != nil {
+			close(hdlr.done)
+		}
+	}
+	hdlr.mu.Unlock()
+	hdlr.wg.Wait()
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	if hdlr.conn == nil && hdlr.Spool.Len() > 0 {
+		// the last try, ignoring backoff
+		if conn, err := net.DialTimeout(hdlr.Network, hdlr.Address, hdlr.Timeout); err == nil {
+			hdlr.conn, hdlr.stream = conn, isStream(hdlr.Network)
+		}
+	}
+	if err := hdlr.drain(); err != nil {
+		fmt.Fprintf(os.Stderr, "Drain spool failed, %d records are left, [%v]\n", hdlr.Spool.Len(), err)
+	}
+	if hdlr.conn != nil {
+		hdlr.conn.Close()
+		hdlr.conn = nil
+	}
+	return hdlr.Spool.Close()
+}
+
+// drain sends all records in Spool
+func (hdlr *SocketHandler) drain() error {
+	for {
+		data, ok := hdlr.Spool.Peek()
+		if !ok {
+			return nil
+		}
+		if err := hdlr.send(data); err != nil {
+			return err
+		}
+		if err := hdlr.Spool.Pop(); err != nil {
+			return err
+		}
+	}
+}
+
+// reconnect starts a goroutine to connect to the peer
+// if it is not connected or connecting
+func (hdlr *SocketHandler) reconnect() {
+	if hdlr.conn != nil || hdlr.dialing || hdlr.closed {
+		return
+	}
+	if hdlr.done == nil {
+		hdlr.done = make(chan struct{})
+	}
+	hdlr.dialing = true
+	hdlr.wg.Add(1)
+	go hdlr.connect(hdlr.done)
+}
+
+// connect connects to the peer until it succeeds or the handler is
+// closed, the tries are delayed with exponential backoff. Records in
+// Spool are sent once it is connected.
+func (hdlr *SocketHandler) connect(done chan struct{}) {
+	defer hdlr.wg.Done()
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	defer func() { hdlr.dialing = false }()
+
+	for {
+		if wait := time.Until(hdlr.backoff.next); wait > 0 {
+			hdlr.mu.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-done:
+				timer.Stop()
+				hdlr.mu.Lock()
+				return
+			}
+			hdlr.mu.Lock()
+		}
+		if hdlr.closed {
+			return
+		}
+
+		hdlr.backoff.min, hdlr.backoff.max = hdlr.MinBackoff, hdlr.MaxBackoff
+		network, address, timeout := hdlr.Network, hdlr.Address, hdlr.Timeout
+		hdlr.mu.Unlock()
+		conn, err := net.DialTimeout(network, address, timeout)
+		hdlr.mu.Lock()
+
+		if err != nil {
+			hdlr.backoff.fail(time.Now())
+			continue
+		}
+		hdlr.conn, hdlr.stream = conn, isStream(network)
+		hdlr.backoff.reset()
+		if err := hdlr.drain(); err == nil || hdlr.conn != nil {
+			return
+		}
+		// lost again while draining
+		hdlr.backoff.fail(time.Now())
+	}
+}
+
+// send writes data to the connection,
+// the connection is closed if it fails
+func (hdlr *SocketHandler) send(data []byte) error {
+	if hdlr.conn == nil {
+		return errors.New("connection is lost")
+	}
+
+	if hdlr.Timeout > 0 {
+		hdlr.conn.SetWriteDeadline(time.Now().Add(hdlr.Timeout))
+	}
+
+	msg := data
+	if hdlr.stream {
+		msg = make([]byte, 4+len(data))
+		binary.BigEndian.PutUint32(msg, uint32(len(data)))
+		copy(msg[4:], data)
+	}
+
+	if _, err := hdlr.conn.Write(msg); err != nil {
+		hdlr.conn.Close()
+		hdlr.conn = nil
+		return err
+	}
+	return nil
+}
+
+// SocketReceiver receives records sent by SocketHandler
+// and re-injects them into local loggers.
+type SocketReceiver struct {
+	Network string
+	Address string
+	// Logger handles received records, if it is nil, records are
+	// handled by the logger with the same name as the sender's
+	Logger *logdog.Logger
+
+	listener   net.Listener
+	packetConn net.PacketConn
+	conns      map[net.Conn]struct{}
+	closed     bool
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+}
+
+// NewSocketReceiver returns a new SocketReceiver listening on address,
+// records are handled by logger
+func NewSocketReceiver(network, address string, logger *logdog.Logger) *SocketReceiver {
+	return &SocketReceiver{
+		Network: network,
+		Address: address,
+		Logger:  logger,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Start listens on the address and starts a goroutine to receive records
+func (r *SocketReceiver) Start() error {
+	if !isStream(r.Network) {
+		conn, err := net.ListenPacket(r.Network, r.Address)
+		if err != nil {
+			return err
+		}
+		r.packetConn = conn
+		r.wg.Add(1)
+		go r.servePacket()
+		return nil
+	}
+
+	listener, err := net.Listen(r.Network, r.Address)
+	if err != nil {
+		return err
+	}
+	r.listener = listener
+	r.wg.Add(1)
+	go r.serve()
+	return nil
+}
+
+// Addr returns the address which the receiver is listening on
+func (r *SocketReceiver) Addr() net.Addr {
+	if r.packetConn != nil {
+		return r.packetConn.LocalAddr()
+	}
+	if r.listener != nil {
+		return r.listener.Addr()
+	}
+	return nil
+}
+
+// Stop stops receiving, closes all connections and
+// waits for all goroutines to exit
+func (r *SocketReceiver) Stop() error {
+	r.mu.Lock()
+	r.closed = true
+	var err error
+	if r.listener != nil {
+		err = r.listener.Close()
+	}
+	if r.packetConn != nil {
+		err = r.packetConn.Close()
+	}
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+func (r *SocketReceiver) serve() {
+	defer r.wg.Done()
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			return
+		}
+		r.conns[conn] = struct{}{}
+		r.wg.Add(1)
+		r.mu.Unlock()
+
+		go r.serveConn(conn)
+	}
+}
+
+func (r *SocketReceiver) serveConn(conn net.Conn) {
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, conn)
+		r.mu.Unlock()
+		conn.Close()
+		r.wg.Done()
+	}()
+
+	reader := bufio.NewReader(conn)
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(header[:])
+		if size > maxRecordSize {
+			fmt.Fprintf(os.Stderr, "Receive record failed, [record size %d exceeds limit]\n", size)
+			return
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return
+		}
+		r.handle(data)
+	}
+}
+
+func (r *SocketReceiver) servePacket() {
+	defer r.wg.Done()
+	buf := make([]byte, 64<<10)
+	for {
+		n, _, err := r.packetConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		r.handle(buf[:n])
+	}
+}
+
+func (r *SocketReceiver) handle(data []byte) {
+	record, err := decodeRecord(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Decode record failed, [%v]\n", err)
+		return
+	}
+
+	logger := r.Logger
+	if logger == nil {
+		logger = logdog.GetLogger(record.Name)
+	}
+	logger.Handle(record)
+}
+
+func init() {
+	logdog.RegisterConstructor("SocketHandler", func() logdog.ConfigLoader {
+		return NewSocketHandler("tcp", "")
+	})
+}
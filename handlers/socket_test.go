@@ -0,0 +1,204 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+)
+
+// waitMessages waits until target receives n messages
+func waitMessages(t *testing.T, target *memHandler, n int) []string {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if messages := target.Messages(); len(messages) >= n {
+			return messages
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d messages, got %v", n, target.Messages())
+	return nil
+}
+
+// freeAddr returns a local TCP address nobody listens on
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestEncodeRecord(t *testing.T) {
+	record := logdog.NewLogRecord("socket", logdog.WarnLevel, "/go/src/app/main.go", "app/main.run", 10,
+		"100%% %s", "done", logdog.Fields{"err": errors.New("oops"), "n": 1, "ch": make(chan int)})
+	data, err := encodeRecord(record)
+	assert.Nil(t, err)
+
+	decoded, err := decodeRecord(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "socket", decoded.Name)
+	assert.Equal(t, logdog.WarnLevel, decoded.Level)
+	assert.Equal(t, "WARN", decoded.LevelName)
+	assert.Equal(t, "main.go", decoded.FileName)
+	assert.Equal(t, "main.run", decoded.FuncName)
+	assert.Equal(t, 10, decoded.Line)
+	assert.True(t, record.Time.Equal(decoded.Time))
+	assert.Equal(t, "100% done", decoded.GetMessage())
+	// unencodable fields are converted to string
+	assert.Equal(t, "oops", decoded.Fields["err"])
+	assert.Equal(t, "1", decoded.Fields["n"])
+}
+
+func TestSocketHandlerTCP(t *testing.T) {
+	target := &memHandler{}
+	receiver := NewSocketReceiver("tcp", "127.0.0.1:0", logdog.NewLogger(logdog.OptionHandlers(target)))
+	assert.Nil(t, receiver.Start())
+	defer receiver.Stop()
+
+	hdlr := NewSocketHandler("tcp", receiver.Addr().String())
+	defer hdlr.Close()
+
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "hello"))
+	record := newLevelRecord(logdog.ErrorLevel, "world")
+	record.Fields = logdog.Fields{"key": "value"}
+	hdlr.Emit(record)
+
+	assert.Equal(t, []string{"hello", "world"}, waitMessages(t, target, 2))
+	records := target.Records()
+	assert.Equal(t, logdog.ErrorLevel, records[1].Level)
+	assert.Equal(t, logdog.Fields{"key": "value"}, records[1].Fields)
+}
+
+func TestSocketHandlerUDP(t *testing.T) {
+	target := &memHandler{}
+	receiver := NewSocketReceiver("udp", "127.0.0.1:0", logdog.NewLogger(logdog.OptionHandlers(target)))
+	assert.Nil(t, receiver.Start())
+	defer receiver.Stop()
+
+	hdlr := NewSocketHandler("udp", receiver.Addr().String())
+	defer hdlr.Close()
+
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "datagram"))
+	assert.Equal(t, []string{"datagram"}, waitMessages(t, target, 1))
+}
+
+func TestSocketReceiverLoggerByName(t *testing.T) {
+	target := &memHandler{}
+	logdog.GetLogger("socket-receiver-test", logdog.OptionHandlers(target))
+
+	receiver := NewSocketReceiver("tcp", "127.0.0.1:0", nil)
+	assert.Nil(t, receiver.Start())
+	defer receiver.Stop()
+
+	hdlr := NewSocketHandler("tcp", receiver.Addr().String())
+	defer hdlr.Close()
+
+	record := newLevelRecord(logdog.InfoLevel, "by name")
+	record.Name = "socket-receiver-test"
+	hdlr.Emit(record)
+	assert.Equal(t, []string{"by name"}, waitMessages(t, target, 1))
+}
+
+func TestSocketHandlerSpool(t *testing.T) {
+	addr := freeAddr(t)
+	spool, err := NewFileSpool(filepath.Join(t.TempDir(), "spool"), 0)
+	assert.Nil(t, err)
+
+	hdlr := NewSocketHandler("tcp", addr)
+	hdlr.Spool = spool
+	hdlr.MinBackoff = 50 * time.Millisecond
+	defer hdlr.Close()
+
+	// the peer is down, records are spooled
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "1"))
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "2"))
+	assert.Equal(t, 2, spool.Len())
+	waitBackoff(t, hdlr)
+	assert.NotNil(t, hdlr.Flush())
+
+	target := &memHandler{}
+	receiver := NewSocketReceiver("tcp", addr, logdog.NewLogger(logdog.OptionHandlers(target)))
+	assert.Nil(t, receiver.Start())
+	defer receiver.Stop()
+
+	// reconnected in background after backoff, without Emit
+	assert.Equal(t, []string{"1", "2"}, waitMessages(t, target, 2))
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "3"))
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "4"))
+	assert.Equal(t, []string{"1", "2", "3", "4"}, waitMessages(t, target, 4))
+	assert.Equal(t, 0, spool.Len())
+	assert.Equal(t, uint64(0), hdlr.Dropped())
+}
+
+// waitBackoff waits until hdlr fails to connect
+func waitBackoff(t *testing.T, hdlr *SocketHandler) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		hdlr.mu.Lock()
+		delay := hdlr.backoff.delay
+		hdlr.mu.Unlock()
+		if delay > 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("expected a failed connection")
+}
+
+func TestSocketHandlerDropped(t *testing.T) {
+	hdlr := NewSocketHandler("tcp", freeAddr(t))
+	hdlr.Spool = NewMemorySpool(1)
+	defer hdlr.Close()
+
+	hdlr.Emit(newLevelRecord(logdog.InfoLevel, "dropped"))
+	assert.Equal(t, 0, hdlr.Spool.Len())
+	assert.Equal(t, uint64(1), hdlr.Dropped())
+}
+
+func TestSocketHandlerLoadConfig(t *testing.T) {
+	hdlr := NewSocketHandler("tcp", "")
+	err := hdlr.LoadConfig(map[string]interface{}{
+		"name":       "socket",
+		"address":    "localhost:9020",
+		"timeout":    "1s",
+		"maxBackoff": "1m",
+		"spool": map[string]interface{}{
+			"path":    filepath.Join(t.TempDir(), "spool"),
+			"maxSize": 100,
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "socket", hdlr.Name)
+	assert.Equal(t, "tcp", hdlr.Network)
+	assert.Equal(t, "localhost:9020", hdlr.Address)
+	assert.Equal(t, time.Second, hdlr.Timeout)
+	assert.Equal(t, DefaultMinBackoff, hdlr.MinBackoff)
+	assert.Equal(t, time.Minute, hdlr.MaxBackoff)
+	if assert.IsType(t, &FileSpool{}, hdlr.Spool) {
+		assert.Equal(t, int64(100), hdlr.Spool.(*FileSpool).MaxSize)
+	}
+	hdlr.Spool.Close()
+
+	assert.NotNil(t, hdlr.LoadConfig(map[string]interface{}{"timeout": "1x"}))
+}
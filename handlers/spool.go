@@ -0,0 +1,271 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const (
+	// DefaultSpoolSize is the default maximum size in bytes of a spool
+	DefaultSpoolSize = 4 << 20
+)
+
+// Spool is a bounded FIFO buffer of encoded records, SocketHandler
+// keeps records in it while the peer is down.
+// A Spool is not safe for concurrent use.
+type Spool interface {
+	// Push appends data to the spool, returns false if
+	// the spool is full and data is dropped
+	Push(data []byte) bool
+	// Peek returns the oldest data in the spool
+	Peek() ([]byte, bool)
+	// Pop removes the oldest data from the spool
+	Pop() error
+	// Len returns the number of data in the spool
+	Len() int
+	// Close releases resources of the spool
+	Close() error
+}
+
+// MemorySpool is a Spool in memory, data is lost when the process exits
+type MemorySpool struct {
+	// MaxSize is the maximum total size in bytes of data
+	MaxSize int64
+
+	queue [][]byte
+	size  int64
+}
+
+// NewMemorySpool returns a MemorySpool holding up to maxSize bytes
+func NewMemorySpool(maxSize int64) *MemorySpool {
+	if maxSize <= 0 {
+		maxSize = DefaultSpoolSize
+	}
+	return &MemorySpool{MaxSize: maxSize}
+}
+
+// Push appends data to the spool
+func (s *MemorySpool) Push(data []byte) bool {
+	if s.size+int64(len(data)) > s.MaxSize {
+		return false
+	}
+	s.queue = append(s.queue, data)
+	s.size += int64(len(data))
+	return true
+}
+
+// Peek returns the oldest data in the spool
+func (s *MemorySpool) Peek() ([]byte, bool) {
+	if len(s.queue) == 0 {
+		return nil, false
+	}
+	return s.queue[0], true
+}
+
+// Pop removes the oldest data from the spool
+func (s *MemorySpool) Pop() error {
+	if len(s.queue) == 0 {
+		return nil
+	}
+	s.size -= int64(len(s.queue[0]))
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	return nil
+}
+
+// Len returns the number of data in the spool
+func (s *MemorySpool) Len() int {
+	return len(s.queue)
+}
+
+// Close drops all data in the spool
+func (s *MemorySpool) Close() error {
+	s.queue = nil
+	s.size = 0
+	return nil
+}
+
+// FileSpool is a Spool on disk, data is appended to a file
+// with a 4-byte big-endian length prefix.
+//
+// Data left in the file are restored by NewFileSpool, so that they
+// survive a restart of the process. The read position is kept in memory
+// only, data popped but not yet truncated may be sent again after a restart.
+type FileSpool struct {
+	// MaxSize is the maximum size in bytes of the spool file
+	MaxSize int64
+
+	path   string
+	file   *os.File
+	offset int64 // read position
+	size   int64 // write position
+	count  int
+}
+
+// NewFileSpool opens the spool file located in path, holding
+// up to maxSize bytes. Data left in the file are restored.
+func NewFileSpool(path string, maxSize int64) (*FileSpool, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultSpoolSize
+	}
+	s := &FileSpool{
+		MaxSize: maxSize,
+		path:    path,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the spool file and restores data in it,
+// a partial entry at the end is truncated
+func (s *FileSpool) open() error {
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0660)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file, s.offset, s.size, s.count = file, 0, 0, 0
+	for {
+		n, err := s.entrySize(s.size)
+		if err != nil || s.size+n > info.Size() {
+			break
+		}
+		s.size += n
+		s.count++
+	}
+	if s.size < info.Size() {
+		return file.Truncate(s.size)
+	}
+	return nil
+}
+
+// entrySize returns the size of entry at offset, including its length prefix
+func (s *FileSpool) entrySize(offset int64) (int64, error) {
+	var header [4]byte
+	if _, err := s.file.ReadAt(header[:], offset); err != nil {
+		return 0, err
+	}
+	return 4 + int64(binary.BigEndian.Uint32(header[:])), nil
+}
+
+// Push appends data to the spool file
+func (s *FileSpool) Push(data []byte) bool {
+	n := 4 + int64(len(data))
+	if s.size-s.offset+n > s.MaxSize {
+		return false
+	}
+	if s.size+n > s.MaxSize {
+		if err := s.compact(); err != nil {
+			return false
+		}
+	}
+
+	entry := make([]byte, n)
+	binary.BigEndian.PutUint32(entry, uint32(len(data)))
+	copy(entry[4:], data)
+	if _, err := s.file.WriteAt(entry, s.size); err != nil {
+		// drop the partial entry
+		s.file.Truncate(s.size)
+		return false
+	}
+	s.size += n
+	s.count++
+	return true
+}
+
+// Peek returns the oldest data in the spool file
+func (s *FileSpool) Peek() ([]byte, bool) {
+	if s.count == 0 {
+		return nil, false
+	}
+	n, err := s.entrySize(s.offset)
+	if err != nil {
+		return nil, false
+	}
+	data := make([]byte, n-4)
+	if _, err := s.file.ReadAt(data, s.offset+4); err != nil && err != io.EOF {
+		return nil, false
+	}
+	return data, true
+}
+
+// Pop removes the oldest data from the spool file,
+// the file is truncated when it is drained
+func (s *FileSpool) Pop() error {
+	if s.count == 0 {
+		return nil
+	}
+	n, err := s.entrySize(s.offset)
+	if err != nil {
+		return err
+	}
+	s.offset += n
+	s.count--
+	if s.count == 0 {
+		s.offset, s.size = 0, 0
+		return s.file.Truncate(0)
+	}
+	return nil
+}
+
+// compact removes popped data from the spool file, data left
+// is written to a temporary file which replaces the spool file
+func (s *FileSpool) compact() error {
+	if s.offset == 0 {
+		return nil
+	}
+
+	tmp := s.path + tmpSuffix
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, io.NewSectionReader(s.file, s.offset, s.size-s.offset))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.file.Close()
+	return s.open()
+}
+
+// Len returns the number of data in the spool file
+func (s *FileSpool) Len() int {
+	return s.count
+}
+
+// Close closes the spool file, data left in it are kept
+func (s *FileSpool) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func drainSpool(t *testing.T, s Spool) []string {
+	result := []string{}
+	for {
+		data, ok := s.Peek()
+		if !ok {
+			return result
+		}
+		result = append(result, string(data))
+		assert.Nil(t, s.Pop())
+	}
+}
+
+func TestMemorySpool(t *testing.T) {
+	s := NewMemorySpool(10)
+	assert.True(t, s.Push([]byte("12345")))
+	assert.True(t, s.Push([]byte("6789")))
+	// full
+	assert.False(t, s.Push([]byte("ab")))
+	assert.Equal(t, 2, s.Len())
+
+	assert.Equal(t, []string{"12345", "6789"}, drainSpool(t, s))
+	assert.True(t, s.Push([]byte("ab")))
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestFileSpoolRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool")
+	s, err := NewFileSpool(path, 1024)
+	assert.Nil(t, err)
+	assert.True(t, s.Push([]byte("first")))
+	assert.True(t, s.Push([]byte("second")))
+	assert.Nil(t, s.Close())
+
+	// a partial entry left by a crash is truncated
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0660)
+	assert.Nil(t, err)
+	file.Write([]byte{0, 0, 0, 10, 'x'})
+	file.Close()
+
+	s, err = NewFileSpool(path, 1024)
+	assert.Nil(t, err)
+	defer s.Close()
+	assert.Equal(t, 2, s.Len())
+	assert.True(t, s.Push([]byte("third")))
+	assert.Equal(t, []string{"first", "second", "third"}, drainSpool(t, s))
+
+	// drained spool file is truncated
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+func TestFileSpoolCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool")
+	// room for 3 entries of 4+6 bytes
+	s, err := NewFileSpool(path, 30)
+	assert.Nil(t, err)
+	defer s.Close()
+
+	assert.True(t, s.Push([]byte("entry1")))
+	assert.True(t, s.Push([]byte("entry2")))
+	assert.True(t, s.Push([]byte("entry3")))
+	assert.False(t, s.Push([]byte("entry4")))
+
+	data, ok := s.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "entry1", string(data))
+	assert.Nil(t, s.Pop())
+
+	// popped entry is compacted to make room
+	assert.True(t, s.Push([]byte("entry4")))
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), info.Size())
+	assert.Equal(t, []string{"entry2", "entry3", "entry4"}, drainSpool(t, s))
+}
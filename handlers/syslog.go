@@ -0,0 +1,515 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zoumo/logdog"
+	"github.com/zoumo/logdog/pkg/pythonic"
+)
+
+// Facility is the syslog facility
+type Facility int
+
+// syslog facilities, see RFC 5424 section 6.2.1
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLpr
+	FacilityNews
+	FacilityUucp
+	FacilityCron
+	FacilityAuthpriv
+	FacilityFtp
+	_ // ntp
+	_ // log audit
+	_ // log alert
+	_ // clock
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+var facilityNames = map[string]Facility{
+	"kern":     FacilityKern,
+	"user":     FacilityUser,
+	"mail":     FacilityMail,
+	"daemon":   FacilityDaemon,
+	"auth":     FacilityAuth,
+	"syslog":   FacilitySyslog,
+	"lpr":      FacilityLpr,
+	"news":     FacilityNews,
+	"uucp":     FacilityUucp,
+	"cron":     FacilityCron,
+	"authpriv": FacilityAuthpriv,
+	"ftp":      FacilityFtp,
+	"local0":   FacilityLocal0,
+	"local1":   FacilityLocal1,
+	"local2":   FacilityLocal2,
+	"local3":   FacilityLocal3,
+	"local4":   FacilityLocal4,
+	"local5":   FacilityLocal5,
+	"local6":   FacilityLocal6,
+	"local7":   FacilityLocal7,
+}
+
+// GetFacility returns the Facility with the given name, e.g. local0
+func GetFacility(name string) (Facility, error) {
+	f, ok := facilityNames[strings.ToLower(name)]
+	if !ok {
+		return FacilityUser, fmt.Errorf("unknown syslog facility: %s", name)
+	}
+	return f, nil
+}
+
+// syslog severities, see RFC 5424 section 6.2.1
+const (
+	severityEmergency = iota
+	severityAlert
+	severityCritical
+	severityError
+	severityWarning
+	severityNotice
+	severityInfo
+	severityDebug
+)
+
+// SyslogSeverity maps a logdog Level to syslog severity.
+// Custom levels are mapped to the severity of the nearest
+// built-in level below them.
+func SyslogSeverity(level logdog.Level) int {
+	switch {
+	case level >= logdog.FatalLevel:
+		return severityCritical
+	case level >= logdog.NoticeLevel:
+		return severityNotice
+	case level >= logdog.ErrorLevel:
+		return severityError
+	case level >= logdog.WarnLevel:
+		return severityWarning
+	case level >= logdog.InfoLevel:
+		return severityInfo
+	}
+	return severityDebug
+}
+
+const (
+	// RFC5424 is the syslog protocol of RFC 5424
+	RFC5424 = "rfc5424"
+	// RFC3164 is the BSD syslog protocol of RFC 3164
+	RFC3164 = "rfc3164"
+
+	// OctetCounting frames a message on stream transports
+	// by prefixing its length, see RFC 6587 section 3.4.1
+	OctetCounting = "octet-counting"
+	// NonTransparent frames a message on stream transports
+	// by appending a LF, see RFC 6587 section 3.4.2
+	NonTransparent = "non-transparent"
+
+	// DefaultSDID is the default SD-ID of structured data
+	// holding record's Fields
+	DefaultSDID = "fields@32473"
+
+	// nilValue is the NILVALUE of RFC 5424
+	nilValue = "-"
+)
+
+var (
+	// localSyslogPaths are the unix sockets of local syslog daemon
+	localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+)
+
+// SyslogHandler is a handler which writes records to syslog over
+// unix socket, UDP or TCP.
+//
+// If Network is empty, the local syslog daemon is connected by unix
+// socket, e.g. /dev/log. On stream transports (tcp and unix), messages
+// are framed by octet-counting or a trailing LF according to Framing.
+// When the connection is lost, it is reconnected with exponential backoff,
+// records emitted during backoff are dropped. Dialing and writing time out
+// after Timeout, a write timing out is treated as a lost connection.
+//
+// With RFC5424 Protocol, record's Fields are encoded as structured data
+// with SD-ID SDID. If Formatter is nil, the message of record is used as MSG.
+type SyslogHandler struct {
+	Name      string
+	Level     logdog.Level
+	Formatter logdog.Formatter
+
+	Network  string
+	Address  string
+	Protocol string
+	Framing  string
+	Facility Facility
+	Hostname string
+	AppName  string
+	ProcID   string
+	SDID     string
+	Timeout  time.Duration
+	logdog.Filterer
+
+	conn    net.Conn
+	stream  bool
+	backoff backoff
+	mu      sync.Mutex
+}
+
+// NewSyslogHandler returns a new SyslogHandler writing to address on
+// network, the connection is established when the first record is emitted
+func NewSyslogHandler(network, address string, options ...logdog.Option) *SyslogHandler {
+	hostname, _ := os.Hostname()
+	hdlr := &SyslogHandler{
+		Name:     "",
+		Level:    logdog.NothingLevel,
+		Network:  network,
+		Address:  address,
+		Protocol: RFC5424,
+		Framing:  OctetCounting,
+		Facility: FacilityUser,
+		Hostname: hostname,
+		AppName:  filepath.Base(os.Args[0]),
+		ProcID:   strconv.Itoa(os.Getpid()),
+		SDID:     DefaultSDID,
+		Timeout:  DefaultSocketTimeout,
+	}
+
+	hdlr.ApplyOptions(options...)
+
+	return hdlr
+}
+
+// ApplyOptions applys all option to SyslogHandler
+func (hdlr *SyslogHandler) ApplyOptions(options ...logdog.Option) *SyslogHandler {
+	logdog.ApplyOptionsTo(hdlr, options...)
+	return hdlr
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (hdlr *SyslogHandler) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	hdlr.Name = config.MustGetString("name", "")
+	hdlr.Level = logdog.GetLevel(config.MustGetString("level", "NOTHING"))
+
+	if _formatter := config.MustGetString("formatter", ""); _formatter != "" {
+		formatter := logdog.GetFormatter(_formatter)
+		if formatter == nil {
+			return fmt.Errorf("can not find formatter: %s", _formatter)
+		}
+		hdlr.Formatter = formatter
+	}
+
+	hdlr.Network = config.MustGetString("network", "")
+	hdlr.Address = config.MustGetString("address", "")
+	hdlr.Protocol = strings.ToLower(config.MustGetString("protocol", RFC5424))
+	if hdlr.Protocol != RFC5424 && hdlr.Protocol != RFC3164 {
+		return fmt.Errorf("unknown syslog protocol: %s", hdlr.Protocol)
+	}
+	hdlr.Framing = strings.ToLower(config.MustGetString("framing", OctetCounting))
+	if hdlr.Framing != OctetCounting && hdlr.Framing != NonTransparent {
+		return fmt.Errorf("unknown syslog framing: %s", hdlr.Framing)
+	}
+	hdlr.Facility, err = GetFacility(config.MustGetString("facility", "user"))
+	if err != nil {
+		return err
+	}
+	hdlr.Hostname = config.MustGetString("hostname", hdlr.Hostname)
+	hdlr.AppName = config.MustGetString("appName", hdlr.AppName)
+	hdlr.ProcID = config.MustGetString("procID", hdlr.ProcID)
+	hdlr.SDID = config.MustGetString("sdID", DefaultSDID)
+	hdlr.Timeout = DefaultSocketTimeout
+	if v := config.MustGetString("timeout", ""); v != "" {
+		if hdlr.Timeout, err = time.ParseDuration(v); err != nil {
+			return err
+		}
+	}
+
+	filters, err := logdog.LoadFilters(c)
+	if err != nil {
+		return err
+	}
+	hdlr.AddFilters(filters...)
+	if hdlr.LevelMask, err = logdog.LoadLevelMask(c); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Emit log record to syslog
+func (hdlr *SyslogHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Filter(record) {
+		return
+	}
+
+	msg, err := hdlr.format(record)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Format record failed, [%v]\n", err)
+		return
+	}
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	if err := hdlr.write(msg); err != nil {
+		fmt.Fprintf(os.Stderr, "Write to syslog failed, [%v]\n", err)
+	}
+}
+
+// Enabled checks if handler takes records at level
+func (hdlr *SyslogHandler) Enabled(level logdog.Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level)
+}
+
+// Filter checks if handler should filter the specified record
+func (hdlr *SyslogHandler) Filter(record *logdog.LogRecord) bool {
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
+}
+
+// Flush does nothing, messages are written without buffering
+func (hdlr *SyslogHandler) Flush() error {
+	return nil
+}
+
+// Close closes the connection to syslog
+func (hdlr *SyslogHandler) Close() error {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	if hdlr.conn == nil {
+		return nil
+	}
+	err := hdlr.conn.Close()
+	hdlr.conn = nil
+	return err
+}
+
+// write writes msg to syslog, it reconnects and retries once if
+// the connection is broken. If the write times out, the peer is
+// stuck, the retry is delayed with backoff instead.
+func (hdlr *SyslogHandler) write(msg string) error {
+	var err error
+	for i := 0; i < 2; i++ {
+		if hdlr.conn == nil {
+			if err = hdlr.connect(); err != nil {
+				return err
+			}
+		}
+		if hdlr.Timeout > 0 {
+			hdlr.conn.SetWriteDeadline(time.Now().Add(hdlr.Timeout))
+		}
+		if _, err = hdlr.conn.Write(hdlr.frame(msg)); err == nil {
+			return nil
+		}
+		hdlr.conn.Close()
+		hdlr.conn = nil
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			hdlr.backoff.fail(time.Now())
+			return err
+		}
+	}
+	return err
+}
+
+// connect connects to syslog, if it fails, the next try
+// is delayed with exponential backoff
+func (hdlr *SyslogHandler) connect() error {
+	now := time.Now()
+	if !hdlr.backoff.ready(now) {
+		return fmt.Errorf("connection is lost, retry after %v", hdlr.backoff.next.Sub(now))
+	}
+
+	conn, stream, err := hdlr.dial()
+	if err != nil {
+		hdlr.backoff.fail(now)
+		return err
+	}
+
+	hdlr.conn, hdlr.stream = conn, stream
+	hdlr.backoff.reset()
+	return nil
+}
+
+func (hdlr *SyslogHandler) dial() (net.Conn, bool, error) {
+	if hdlr.Network != "" {
+		conn, err := net.DialTimeout(hdlr.Network, hdlr.Address, hdlr.Timeout)
+		if err != nil {
+			return nil, false, err
+		}
+		stream := hdlr.Network != "udp" && hdlr.Network != "udp4" &&
+			hdlr.Network != "udp6" && hdlr.Network != "unixgram"
+		return conn, stream, nil
+	}
+
+	// local syslog daemon
+	paths := localSyslogPaths
+	if hdlr.Address != "" {
+		paths = []string{hdlr.Address}
+	}
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range paths {
+			conn, err := net.DialTimeout(network, path, hdlr.Timeout)
+			if err == nil {
+				return conn, network == "unix", nil
+			}
+		}
+	}
+	return nil, false, errors.New("unix syslog delivery error")
+}
+
+// frame frames msg for stream transports
+func (hdlr *SyslogHandler) frame(msg string) []byte {
+	if !hdlr.stream {
+		return []byte(msg)
+	}
+	if hdlr.Framing == NonTransparent {
+		return []byte(msg + "\n")
+	}
+	return []byte(strconv.Itoa(len(msg)) + " " + msg)
+}
+
+// format converts record to a syslog message
+func (hdlr *SyslogHandler) format(record *logdog.LogRecord) (string, error) {
+	msg := ""
+	if hdlr.Formatter == nil {
+		msg = record.GetMessage()
+	} else {
+		var err error
+		if msg, err = hdlr.Formatter.Format(record); err != nil {
+			return "", err
+		}
+	}
+
+	pri := int(hdlr.Facility)*8 + SyslogSeverity(record.Level)
+
+	if hdlr.Protocol == RFC3164 {
+		tag := hdlr.AppName
+		if hdlr.ProcID != "" {
+			tag += "[" + hdlr.ProcID + "]"
+		}
+		timestamp := record.Time.Format(time.Stamp)
+		if hdlr.Network == "" {
+			// the local syslog daemon adds hostname itself
+			return fmt.Sprintf("<%d>%s %s: %s", pri, timestamp, tag, msg), nil
+		}
+		return fmt.Sprintf("<%d>%s %s %s: %s", pri, timestamp, hdlr.Hostname, tag, msg), nil
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s",
+		pri,
+		record.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerValue(hdlr.Hostname, 255),
+		headerValue(hdlr.AppName, 48),
+		headerValue(hdlr.ProcID, 128),
+		nilValue,
+		hdlr.structuredData(record.AllFields()),
+		msg,
+	), nil
+}
+
+// structuredData encodes fields as a SD-ELEMENT sorted by key
+func (hdlr *SyslogHandler) structuredData(fields logdog.Fields) string {
+	if len(fields) == 0 {
+		return nilValue
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("[")
+	buf.WriteString(sdName(hdlr.SDID))
+	for _, k := range keys {
+		v := fields[k]
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(time.RFC3339)
+		}
+		buf.WriteString(" ")
+		buf.WriteString(sdName(k))
+		buf.WriteString(`="`)
+		sdEscaper.WriteString(buf, fmt.Sprintf("%+v", v))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
+
+// sdEscaper escapes '"', '\' and ']' in PARAM-VALUE
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// sdName converts s to a valid SD-NAME, which is at most 32
+// printable US-ASCII characters except '=', SP, ']' and '"'
+func sdName(s string) string {
+	name := []byte{}
+	for i := 0; i < len(s) && len(name) < 32; i++ {
+		c := s[i]
+		if c <= 32 || c >= 127 || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		name = append(name, c)
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
+
+// headerValue converts s to a valid header field of RFC 5424,
+// which is at most max printable US-ASCII characters or NILVALUE
+func headerValue(s string, max int) string {
+	value := []byte{}
+	for i := 0; i < len(s) && len(value) < max; i++ {
+		if c := s[i]; c > 32 && c < 127 {
+			value = append(value, c)
+		}
+	}
+	if len(value) == 0 {
+		return nilValue
+	}
+	return string(value)
+}
+
+func init() {
+	logdog.RegisterConstructor("SyslogHandler", func() logdog.ConfigLoader {
+		return NewSyslogHandler("", "")
+	})
+}
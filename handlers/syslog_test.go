@@ -0,0 +1,306 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+)
+
+func newSyslogRecord(level logdog.Level, msg string, fields logdog.Fields) *logdog.LogRecord {
+	record := newLevelRecord(level, msg)
+	record.Time = time.Date(2016, 11, 1, 8, 9, 10, 123456000, time.UTC)
+	record.Fields = fields
+	return record
+}
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+// readOctetCounting reads a message framed by octet-counting
+func readOctetCounting(t *testing.T, r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	assert.Equal(t, 7, SyslogSeverity(logdog.DebugLevel))
+	assert.Equal(t, 6, SyslogSeverity(logdog.InfoLevel))
+	assert.Equal(t, 5, SyslogSeverity(logdog.NoticeLevel))
+	assert.Equal(t, 4, SyslogSeverity(logdog.WarnLevel))
+	assert.Equal(t, 3, SyslogSeverity(logdog.ErrorLevel))
+	assert.Equal(t, 2, SyslogSeverity(logdog.FatalLevel))
+}
+
+func TestSyslogHandlerRFC5424UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	hdlr := NewSyslogHandler("udp", conn.LocalAddr().String())
+	hdlr.Facility = FacilityLocal0
+	hdlr.Hostname = "host"
+	hdlr.AppName = "app"
+	hdlr.ProcID = "42"
+	defer hdlr.Close()
+
+	hdlr.Emit(newSyslogRecord(logdog.ErrorLevel, "disk full", logdog.Fields{
+		"path":  "/var",
+		"quote": `a"b]c\`,
+		"a=b c": 1,
+	}))
+	assert.Equal(t,
+		`<131>1 2016-11-01T08:09:10.123456Z host app 42 - [fields@32473 a_b_c="1" path="/var" quote="a\"b\]c\\"] disk full`,
+		readPacket(t, conn))
+
+	hdlr.Emit(newSyslogRecord(logdog.InfoLevel, "no fields", nil))
+	assert.Equal(t, "<134>1 2016-11-01T08:09:10.123456Z host app 42 - - no fields", readPacket(t, conn))
+}
+
+func TestSyslogHandlerRFC3164(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	hdlr := NewSyslogHandler("udp", conn.LocalAddr().String())
+	hdlr.Protocol = RFC3164
+	hdlr.Facility = FacilityDaemon
+	hdlr.Hostname = "host"
+	hdlr.AppName = "app"
+	hdlr.ProcID = "42"
+	defer hdlr.Close()
+
+	hdlr.Emit(newSyslogRecord(logdog.WarnLevel, "warning", nil))
+	assert.Equal(t, "<28>Nov  1 08:09:10 host app[42]: warning", readPacket(t, conn))
+}
+
+func TestSyslogHandlerUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+
+	// empty network means the local syslog daemon
+	hdlr := NewSyslogHandler("", path)
+	hdlr.Protocol = RFC3164
+	hdlr.AppName = "app"
+	hdlr.ProcID = ""
+	defer hdlr.Close()
+
+	hdlr.Emit(newSyslogRecord(logdog.DebugLevel, "local", nil))
+	assert.Equal(t, "<15>Nov  1 08:09:10 app: local", readPacket(t, conn))
+}
+
+func TestSyslogHandlerTCPReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	hdlr := NewSyslogHandler("tcp", ln.Addr().String())
+	hdlr.Hostname = "host"
+	hdlr.AppName = "app"
+	hdlr.ProcID = "42"
+	defer hdlr.Close()
+
+	hdlr.Emit(newSyslogRecord(logdog.InfoLevel, "first", nil))
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	assert.Equal(t, "<14>1 2016-11-01T08:09:10.123456Z host app 42 - - first", readOctetCounting(t, bufio.NewReader(conn)))
+
+	// the server drops the connection, the handler should reconnect
+	conn.Close()
+	// the first write after peer closed may still succeed,
+	// keep writing until a new connection is accepted
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	var conn2 net.Conn
+	for i := 0; conn2 == nil && i < 100; i++ {
+		hdlr.Emit(newSyslogRecord(logdog.InfoLevel, "again", nil))
+		select {
+		case conn2 = <-accepted:
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	if conn2 == nil {
+		t.Fatal("handler did not reconnect")
+	}
+	defer conn2.Close()
+
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	assert.Equal(t, "<14>1 2016-11-01T08:09:10.123456Z host app 42 - - again", readOctetCounting(t, bufio.NewReader(conn2)))
+}
+
+func TestSyslogHandlerBackoff(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	hdlr := NewSyslogHandler("tcp", addr)
+	defer hdlr.Close()
+
+	assert.Error(t, hdlr.connect())
+	assert.Equal(t, DefaultMinBackoff, hdlr.backoff.delay)
+	// retry is delayed
+	assert.Error(t, hdlr.connect())
+	assert.Equal(t, DefaultMinBackoff, hdlr.backoff.delay)
+
+	hdlr.backoff.next = time.Time{}
+	assert.Error(t, hdlr.connect())
+	assert.Equal(t, 2*DefaultMinBackoff, hdlr.backoff.delay)
+}
+
+func TestSyslogHandlerWriteTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// accept but never read
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			<-stop
+			conn.Close()
+		}
+	}()
+
+	hdlr := NewSyslogHandler("tcp", ln.Addr().String())
+	hdlr.Timeout = 50 * time.Millisecond
+	defer hdlr.Close()
+
+	record := newSyslogRecord(logdog.InfoLevel, strings.Repeat("x", 1<<20), nil)
+	msg, err := hdlr.format(record)
+	assert.Nil(t, err)
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	start := time.Now()
+	for i := 0; i < 100 && err == nil; i++ {
+		err = hdlr.write(msg)
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	assert.True(t, time.Since(start) < 5*time.Second)
+	// treated as a lost connection, the retry waits for backoff
+	assert.Nil(t, hdlr.conn)
+	assert.Equal(t, DefaultMinBackoff, hdlr.backoff.delay)
+	assert.Error(t, hdlr.write(msg))
+	assert.Nil(t, hdlr.conn)
+}
+
+func TestSyslogHandlerNonTransparentFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	hdlr := NewSyslogHandler("tcp", ln.Addr().String())
+	hdlr.Protocol = RFC3164
+	hdlr.Framing = NonTransparent
+	hdlr.Hostname = "host"
+	hdlr.AppName = "app"
+	hdlr.ProcID = "42"
+	defer hdlr.Close()
+
+	hdlr.Emit(newSyslogRecord(logdog.InfoLevel, "line", nil))
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "<14>Nov  1 08:09:10 host app[42]: line\n", line)
+}
+
+func TestSyslogHandlerLoadConfig(t *testing.T) {
+	hdlr := NewSyslogHandler("", "")
+	err := hdlr.LoadConfig(map[string]interface{}{
+		"name":     "syslog",
+		"level":    "INFO",
+		"network":  "tcp",
+		"address":  "localhost:514",
+		"protocol": "RFC3164",
+		"framing":  "non-transparent",
+		"facility": "local7",
+		"appName":  "app",
+		"timeout":  "1s",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "syslog", hdlr.Name)
+	assert.Equal(t, logdog.InfoLevel, hdlr.Level)
+	assert.Equal(t, "tcp", hdlr.Network)
+	assert.Equal(t, RFC3164, hdlr.Protocol)
+	assert.Equal(t, NonTransparent, hdlr.Framing)
+	assert.Equal(t, FacilityLocal7, hdlr.Facility)
+	assert.Equal(t, "app", hdlr.AppName)
+	assert.Equal(t, time.Second, hdlr.Timeout)
+
+	assert.Error(t, hdlr.LoadConfig(map[string]interface{}{"facility": "unknown"}))
+	assert.Error(t, hdlr.LoadConfig(map[string]interface{}{"protocol": "rfc1"}))
+	assert.Error(t, hdlr.LoadConfig(map[string]interface{}{"timeout": "1x"}))
+}
@@ -0,0 +1,489 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zoumo/logdog"
+	"github.com/zoumo/logdog/pkg/pythonic"
+	"github.com/zoumo/logdog/pkg/when"
+)
+
+// TimedRotatingFileHandler is a FileHandler which rotates the log file
+// at certain timed intervals, likes python's TimedRotatingFileHandler.
+//
+// When specifies the type of interval:
+//
+// S           Seconds
+// M           Minutes
+// H           Hours
+// D           Days, counted from the time the file is opened
+// MIDNIGHT    Roll over at midnight
+// W0-W6       Roll over at midnight of the weekday (W0 is Monday)
+//
+// S, M and H are aligned to the boundary of their unit. The interval is
+// multiplied by Interval. If Timedelta is not zero, it is used as a custom
+// interval instead and When is ignored.
+//
+// The rotated file is named by appending the start time of its interval
+// formatted with Suffix (see when.Strftime) to Path, e.g. app.log.2016-11-01.
+// Suffix must be parsed back by when.Strptime to find backups, so directives
+// like %U or %Z are not supported.
+// If BackupCount is greater than zero, backups older than BackupCount
+// intervals are deleted on rollover.
+//
+// If Retention is set, the rotated file is compressed and pruned in background.
+// Files left by a crash in the middle of this are picked up when the file
+// is opened by SetPath or LoadConfig.
+type TimedRotatingFileHandler struct {
+	logdog.FileHandler
+
+	When        string
+	Interval    int
+	Timedelta   when.Timedelta
+	Suffix      string
+	BackupCount int
+	UTC         bool
+	Retention   *RetentionPolicy
+
+	// RolloverAt is the time of next rollover, it is computed from
+	// the modification time of the file the first time a record is emitted
+	RolloverAt time.Time
+
+	mu sync.Mutex
+}
+
+// NewTimedRotatingFileHandler returns a new TimedRotatingFileHandler
+// rotating at midnight by default
+func NewTimedRotatingFileHandler(options ...logdog.Option) *TimedRotatingFileHandler {
+	hdlr := &TimedRotatingFileHandler{
+		FileHandler: logdog.FileHandler{
+			Output:    logdog.Discard,
+			Level:     logdog.NothingLevel,
+			Formatter: logdog.DefaultFormatter,
+		},
+		When:     "MIDNIGHT",
+		Interval: 1,
+	}
+
+	hdlr.ApplyOptions(options...)
+
+	return hdlr
+}
+
+// ApplyOptions applys all option to TimedRotatingFileHandler
+func (hdlr *TimedRotatingFileHandler) ApplyOptions(options ...logdog.Option) *TimedRotatingFileHandler {
+	hdlr.FileHandler.ApplyOptions(options...)
+	return hdlr
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (hdlr *TimedRotatingFileHandler) LoadConfig(c map[string]interface{}) error {
+	if err := hdlr.FileHandler.LoadConfig(c); err != nil {
+		return err
+	}
+
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	hdlr.When = config.MustGetString("when", "MIDNIGHT")
+	hdlr.Interval = config.MustGetInt("interval", 1)
+	hdlr.Suffix = config.MustGetString("suffix", "")
+	hdlr.BackupCount = config.MustGetInt("backupCount", 0)
+	hdlr.UTC = config.MustGetBool("utc", false)
+
+	delta := config.MustGetDict("timedelta", pythonic.Dict{})
+	hdlr.Timedelta = when.Timedelta{
+		Weeks:        time.Duration(delta.MustGetInt("weeks", 0)),
+		Days:         time.Duration(delta.MustGetInt("days", 0)),
+		Hours:        time.Duration(delta.MustGetInt("hours", 0)),
+		Minutes:      time.Duration(delta.MustGetInt("minutes", 0)),
+		Seconds:      time.Duration(delta.MustGetInt("seconds", 0)),
+		Milliseconds: time.Duration(delta.MustGetInt("milliseconds", 0)),
+	}
+
+	if _, err := hdlr.period(); err != nil {
+		return err
+	}
+	if err := hdlr.checkSuffix(); err != nil {
+		return err
+	}
+
+	hdlr.Retention, err = loadRetention(c)
+	if err != nil {
+		return err
+	}
+
+	hdlr.recoverFiles()
+	return nil
+}
+
+// SetPath opens file located in the path, if not, create it
+func (hdlr *TimedRotatingFileHandler) SetPath(path string) *TimedRotatingFileHandler {
+	hdlr.FileHandler.SetPath(path)
+	hdlr.recoverFiles()
+	return hdlr
+}
+
+// recoverFiles finishes the work left by a crash when the file is opened.
+// Stale files of compression are removed, and backups are
+// compressed and pruned by Retention.
+func (hdlr *TimedRotatingFileHandler) recoverFiles() {
+	if hdlr.Path == "" {
+		return
+	}
+	if hdlr.Retention != nil {
+		// do not race with jobs of the file opened before
+		hdlr.Retention.Wait()
+	}
+
+	removeStaleFiles(hdlr.Path)
+
+	if hdlr.Retention != nil {
+		hdlr.Retention.Recover(hdlr.backups)
+	}
+}
+
+// Emit log record to file, rollover the file before
+// the record is written if the rollover time is reached
+func (hdlr *TimedRotatingFileHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Output == nil || hdlr.Formatter == nil {
+		panic("you should set output and fomatter before use this handler")
+	}
+
+	if hdlr.Filter(record) {
+		return
+	}
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	msg, err := hdlr.Formatter.Format(record)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Format record failed, [%v]\n", err)
+		return
+	}
+
+	now := hdlr.now()
+	if hdlr.RolloverAt.IsZero() {
+		hdlr.RolloverAt, err = hdlr.computeRollover(hdlr.modTime(now))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Compute rollover time failed, [%v]\n", err)
+		}
+		if err := hdlr.checkSuffix(); err != nil {
+			fmt.Fprintf(os.Stderr, "Check suffix failed, backups will not be found, [%v]\n", err)
+		}
+	}
+
+	if !hdlr.RolloverAt.IsZero() && !now.Before(hdlr.RolloverAt) {
+		if err := hdlr.doRollover(now); err != nil {
+			fmt.Fprintf(os.Stderr, "Rollover file %s failed, [%v]\n", hdlr.Path, err)
+		}
+	}
+
+	fmt.Fprintln(hdlr.Output, msg)
+}
+
+func (hdlr *TimedRotatingFileHandler) now() time.Time {
+	if hdlr.UTC {
+		return time.Now().UTC()
+	}
+	return time.Now()
+}
+
+// modTime returns the modification time of the file,
+// or def if it is not available
+func (hdlr *TimedRotatingFileHandler) modTime(def time.Time) time.Time {
+	info, err := os.Stat(hdlr.Path)
+	if err != nil {
+		return def
+	}
+	if hdlr.UTC {
+		return info.ModTime().UTC()
+	}
+	return info.ModTime().Local()
+}
+
+func (hdlr *TimedRotatingFileHandler) when() string {
+	return strings.ToUpper(hdlr.When)
+}
+
+func (hdlr *TimedRotatingFileHandler) interval() int {
+	if hdlr.Interval <= 0 {
+		return 1
+	}
+	return hdlr.Interval
+}
+
+func (hdlr *TimedRotatingFileHandler) custom() bool {
+	return hdlr.Timedelta.Duration() > 0
+}
+
+// weekday parses W0-W6 and returns the target weekday, 0 is Monday
+func (hdlr *TimedRotatingFileHandler) weekday() (int, bool) {
+	w := hdlr.when()
+	if len(w) != 2 || w[0] != 'W' || w[1] < '0' || w[1] > '6' {
+		return 0, false
+	}
+	return int(w[1] - '0'), true
+}
+
+// period returns the length of one interval
+func (hdlr *TimedRotatingFileHandler) period() (time.Duration, error) {
+	if hdlr.custom() {
+		return hdlr.Timedelta.Duration(), nil
+	}
+
+	interval := time.Duration(hdlr.interval())
+	switch hdlr.when() {
+	case "S":
+		return interval * time.Second, nil
+	case "M":
+		return interval * time.Minute, nil
+	case "H":
+		return interval * time.Hour, nil
+	case "D", "MIDNIGHT":
+		return interval * 24 * time.Hour, nil
+	}
+
+	if _, ok := hdlr.weekday(); ok {
+		return interval * 7 * 24 * time.Hour, nil
+	}
+
+	return 0, fmt.Errorf("invalid rollover interval specified: %s", hdlr.When)
+}
+
+// suffix returns the strftime pattern of rotated file name
+func (hdlr *TimedRotatingFileHandler) suffix() string {
+	if hdlr.Suffix != "" {
+		return hdlr.Suffix
+	}
+	if hdlr.custom() {
+		return "%Y-%m-%d_%H-%M-%S"
+	}
+	switch hdlr.when() {
+	case "S":
+		return "%Y-%m-%d_%H-%M-%S"
+	case "M":
+		return "%Y-%m-%d_%H-%M"
+	case "H":
+		return "%Y-%m-%d_%H"
+	}
+	return "%Y-%m-%d"
+}
+
+// checkSuffix checks that a time formatted with the suffix can be
+// parsed back, otherwise backups can not be found to be deleted
+func (hdlr *TimedRotatingFileHandler) checkSuffix() error {
+	suffix := hdlr.suffix()
+	t := time.Date(2017, 11, 23, 13, 4, 5, 0, time.UTC)
+	text := when.Strftime(&t, suffix)
+	parsed, err := when.Strptime(text, suffix, time.UTC)
+	if err != nil {
+		return fmt.Errorf("unsupported suffix %s: %v", suffix, err)
+	}
+	if when.Strftime(&parsed, suffix) != text {
+		return fmt.Errorf("unsupported suffix %s: it can not be parsed back", suffix)
+	}
+	return nil
+}
+
+// computeRollover returns the first rollover time after t
+func (hdlr *TimedRotatingFileHandler) computeRollover(t time.Time) (time.Time, error) {
+	period, err := hdlr.period()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if hdlr.custom() {
+		return t.Add(period), nil
+	}
+
+	interval := hdlr.interval()
+	nextMidnight := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+
+	// align to the boundary in the location of t, Truncate works in UTC
+	// which is wrong for zones like +05:30
+	y, m, d := t.Date()
+	switch hdlr.when() {
+	case "S":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, t.Location()).Add(period), nil
+	case "M":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, t.Location()).Add(period), nil
+	case "H":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location()).Add(period), nil
+	case "D":
+		return t.Add(period), nil
+	case "MIDNIGHT":
+		return nextMidnight.AddDate(0, 0, interval-1), nil
+	}
+
+	// W0-W6
+	day, _ := hdlr.weekday()
+	for (int(nextMidnight.Weekday())+6)%7 != day {
+		nextMidnight = nextMidnight.AddDate(0, 0, 1)
+	}
+	return nextMidnight.AddDate(0, 0, 7*(interval-1)), nil
+}
+
+// periodStart returns the start time of the interval ending at end
+func (hdlr *TimedRotatingFileHandler) periodStart(end time.Time) time.Time {
+	period, _ := hdlr.period()
+	if hdlr.custom() {
+		return end.Add(-period)
+	}
+	switch hdlr.when() {
+	case "S", "M", "H", "D":
+		return end.Add(-period)
+	case "MIDNIGHT":
+		return end.AddDate(0, 0, -hdlr.interval())
+	}
+	return end.AddDate(0, 0, -7*hdlr.interval())
+}
+
+// doRollover renames the current file with a time suffix,
+// deletes expired backups and reopens the file located in Path
+func (hdlr *TimedRotatingFileHandler) doRollover(now time.Time) error {
+	if hdlr.Output != nil {
+		hdlr.Output.Close()
+	}
+
+	start := hdlr.periodStart(hdlr.RolloverAt)
+	dfn := hdlr.Path + "." + when.Strftime(&start, hdlr.suffix())
+	os.Remove(dfn)
+	renameErr := os.Rename(hdlr.Path, dfn)
+
+	cutoff := hdlr.RolloverAt
+	for i := 0; i < hdlr.BackupCount; i++ {
+		cutoff = hdlr.periodStart(cutoff)
+	}
+	if hdlr.Retention == nil {
+		hdlr.deleteExpired(cutoff)
+	} else if renameErr == nil {
+		hdlr.Retention.Schedule(func() {
+			if _, err := hdlr.Retention.Compress(dfn); err != nil {
+				fmt.Fprintf(os.Stderr, "Compress file %s failed, [%v]\n", dfn, err)
+			}
+			hdlr.deleteExpired(cutoff)
+			if err := hdlr.Retention.Prune(hdlr.backups()); err != nil {
+				fmt.Fprintf(os.Stderr, "Prune backups failed, [%v]\n", err)
+			}
+		})
+	}
+
+	next, err := hdlr.computeRollover(now)
+	if err != nil {
+		return err
+	}
+	hdlr.RolloverAt = next
+
+	// reopen the file even if rename failed, otherwise
+	// all records after this would be lost
+	file, err := os.OpenFile(hdlr.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		hdlr.Output = logdog.Discard
+		return err
+	}
+	hdlr.Output = file
+
+	return renameErr
+}
+
+// deleteExpired removes backups whose interval started before cutoff
+// if BackupCount is greater than zero
+func (hdlr *TimedRotatingFileHandler) deleteExpired(cutoff time.Time) {
+	if hdlr.BackupCount <= 0 {
+		return
+	}
+	for _, name := range hdlr.getFilesToDelete(cutoff) {
+		os.Remove(name)
+	}
+}
+
+// getFilesToDelete returns backups whose interval started before cutoff
+func (hdlr *TimedRotatingFileHandler) getFilesToDelete(cutoff time.Time) []string {
+	result := []string{}
+	for name, t := range hdlr.backupTimes(cutoff.Location()) {
+		if t.Before(cutoff) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// backups returns all existing backups, both plain and compressed ones
+func (hdlr *TimedRotatingFileHandler) backups() []string {
+	loc := time.Local
+	if hdlr.UTC {
+		loc = time.UTC
+	}
+	result := []string{}
+	for name := range hdlr.backupTimes(loc) {
+		result = append(result, name)
+	}
+	return result
+}
+
+// backupTimes returns the start time of interval of each backup
+func (hdlr *TimedRotatingFileHandler) backupTimes(loc *time.Location) map[string]time.Time {
+	dir, base := filepath.Split(hdlr.Path)
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	prefix := base + "."
+	result := make(map[string]time.Time)
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		suffix := trimCompressedExt(name[len(prefix):])
+		t, err := when.Strptime(suffix, hdlr.suffix(), loc)
+		if err != nil {
+			continue
+		}
+		result[filepath.Join(dir, name)] = t
+	}
+	return result
+}
+
+// Close waits for background compression and closes the file
+func (hdlr *TimedRotatingFileHandler) Close() error {
+	if hdlr.Retention != nil {
+		hdlr.Retention.Wait()
+	}
+	return hdlr.FileHandler.Close()
+}
+
+func init() {
+	logdog.RegisterConstructor("TimedRotatingFileHandler", func() logdog.ConfigLoader {
+		return NewTimedRotatingFileHandler()
+	})
+}
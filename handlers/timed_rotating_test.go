@@ -0,0 +1,212 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+	"github.com/zoumo/logdog/pkg/when"
+)
+
+func TestTimedRotatingFileHandlerComputeRollover(t *testing.T) {
+	// 2016-11-02 is Wednesday
+	now := time.Date(2016, 11, 2, 10, 30, 15, 0, time.UTC)
+
+	hdlr := NewTimedRotatingFileHandler()
+	cases := []struct {
+		when     string
+		interval int
+		expected time.Time
+	}{
+		{"S", 1, time.Date(2016, 11, 2, 10, 30, 16, 0, time.UTC)},
+		{"M", 5, time.Date(2016, 11, 2, 10, 35, 0, 0, time.UTC)},
+		{"H", 1, time.Date(2016, 11, 2, 11, 0, 0, 0, time.UTC)},
+		{"D", 1, time.Date(2016, 11, 3, 10, 30, 15, 0, time.UTC)},
+		{"midnight", 1, time.Date(2016, 11, 3, 0, 0, 0, 0, time.UTC)},
+		{"MIDNIGHT", 2, time.Date(2016, 11, 4, 0, 0, 0, 0, time.UTC)},
+		{"W0", 1, time.Date(2016, 11, 7, 0, 0, 0, 0, time.UTC)},
+		{"W3", 1, time.Date(2016, 11, 3, 0, 0, 0, 0, time.UTC)},
+		{"W2", 1, time.Date(2016, 11, 9, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		hdlr.When, hdlr.Interval = c.when, c.interval
+		next, err := hdlr.computeRollover(now)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, next, c.when)
+	}
+
+	hdlr.Timedelta = when.Timedelta{Hours: 1, Minutes: 30}
+	next, err := hdlr.computeRollover(now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2016, 11, 2, 12, 0, 15, 0, time.UTC), next)
+
+	// boundaries are aligned in the location of now
+	india := time.FixedZone("IST", 5*3600+1800)
+	now = time.Date(2016, 11, 2, 10, 40, 15, 0, india)
+	hdlr.Timedelta = when.Timedelta{}
+	for _, c := range []struct {
+		when     string
+		interval int
+		expected time.Time
+	}{
+		{"S", 1, time.Date(2016, 11, 2, 10, 40, 16, 0, india)},
+		{"M", 5, time.Date(2016, 11, 2, 10, 45, 0, 0, india)},
+		{"H", 1, time.Date(2016, 11, 2, 11, 0, 0, 0, india)},
+		{"H", 2, time.Date(2016, 11, 2, 12, 0, 0, 0, india)},
+	} {
+		hdlr.When, hdlr.Interval = c.when, c.interval
+		next, err := hdlr.computeRollover(now)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, next, c.when)
+	}
+
+	hdlr.When = "W7"
+	_, err = hdlr.computeRollover(now)
+	assert.Error(t, err)
+}
+
+func TestTimedRotatingFileHandlerRollover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	hdlr := NewTimedRotatingFileHandler(&logdog.TextFormatter{Fmt: "%(message)"})
+	hdlr.UTC = true
+	hdlr.FileHandler.SetPath(path)
+	defer hdlr.Close()
+
+	hdlr.Emit(newRecord("first"))
+	now := time.Now().UTC()
+	assert.Equal(t, time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC), hdlr.RolloverAt)
+
+	hdlr.RolloverAt = time.Date(2016, 11, 2, 0, 0, 0, 0, time.UTC)
+	hdlr.Emit(newRecord("second"))
+
+	assert.Equal(t, []string{"first"}, readLines(t, path+".2016-11-01"))
+	assert.Equal(t, []string{"second"}, readLines(t, path))
+	assert.True(t, hdlr.RolloverAt.After(now))
+}
+
+func TestTimedRotatingFileHandlerRetention(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	for _, name := range []string{"app.log.2016-10-28", "app.log.2016-10-29", "app.log.2016-10-30", "app.log.other"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0660))
+	}
+
+	hdlr := NewTimedRotatingFileHandler()
+	hdlr.When = "D"
+	hdlr.BackupCount = 2
+	hdlr.UTC = true
+	hdlr.FileHandler.SetPath(path)
+	defer hdlr.Close()
+
+	hdlr.RolloverAt = time.Date(2016, 11, 1, 0, 0, 0, 0, time.UTC)
+	hdlr.Emit(newRecord("test"))
+
+	infos, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	assert.Equal(t, []string{"app.log", "app.log.2016-10-30", "app.log.2016-10-31", "app.log.other"}, names)
+}
+
+func TestTimedRotatingFileHandlerNamedSuffix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	for _, name := range []string{"app.log.28-Oct-2016", "app.log.29-Oct-2016", "app.log.30-Oct-2016", "app.log.other"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0660))
+	}
+
+	hdlr := NewTimedRotatingFileHandler()
+	hdlr.When = "D"
+	hdlr.Suffix = "%d-%b-%Y"
+	hdlr.BackupCount = 2
+	hdlr.UTC = true
+	hdlr.FileHandler.SetPath(path)
+	defer hdlr.Close()
+
+	hdlr.RolloverAt = time.Date(2016, 11, 1, 0, 0, 0, 0, time.UTC)
+	hdlr.Emit(newRecord("test"))
+
+	infos, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	assert.Equal(t, []string{"app.log", "app.log.30-Oct-2016", "app.log.31-Oct-2016", "app.log.other"}, names)
+
+	// suffixes which can not be parsed back are rejected
+	for _, suffix := range []string{"%Y-%U", "%Y-%m-%d %Z", "%a"} {
+		hdlr := NewTimedRotatingFileHandler()
+		err = hdlr.LoadConfig(logdog.Config{
+			"filename": path,
+			"suffix":   suffix,
+		})
+		assert.Error(t, err, suffix)
+		assert.Nil(t, hdlr.Close())
+	}
+}
+
+func TestTimedRotatingFileHandlerLoadJSONConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	config := []byte(`{
+        "handlers": {
+            "timed": {
+                "class": "TimedRotatingFileHandler",
+                "filename": "` + path + `",
+                "when": "H",
+                "interval": 2,
+                "timedelta": {"minutes": 30},
+                "suffix": "%Y%m%d%H%M",
+                "backupCount": 24,
+                "utc": true
+            }
+        }
+    }`)
+
+	err := logdog.LoadJSONConfig(config)
+	assert.Nil(t, err)
+
+	hdlr, ok := logdog.GetHandler("timed").(*TimedRotatingFileHandler)
+	assert.True(t, ok)
+	assert.Equal(t, "H", hdlr.When)
+	assert.Equal(t, 2, hdlr.Interval)
+	assert.Equal(t, 30*time.Minute, hdlr.Timedelta.Duration())
+	assert.Equal(t, "%Y%m%d%H%M", hdlr.Suffix)
+	assert.Equal(t, 24, hdlr.BackupCount)
+	assert.True(t, hdlr.UTC)
+	assert.Nil(t, hdlr.Close())
+
+	hdlr = NewTimedRotatingFileHandler()
+	err = hdlr.LoadConfig(logdog.Config{
+		"filename": path,
+		"when":     "fortnight",
+	})
+	assert.Error(t, err)
+	assert.Nil(t, hdlr.Close())
+}
+
+func TestTimedRotatingFileHandlerInterface(t *testing.T) {
+	assert.Implements(t, (*logdog.Handler)(nil), NewTimedRotatingFileHandler())
+	assert.Implements(t, (*logdog.ConfigLoader)(nil), NewTimedRotatingFileHandler())
+}
@@ -0,0 +1,197 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zoumo/logdog"
+	"github.com/zoumo/logdog/pkg/pythonic"
+)
+
+type statter interface {
+	Stat() (os.FileInfo, error)
+}
+
+// WatchedFileHandler is a FileHandler which watches the file it is
+// logging to, likes python's WatchedFileHandler.
+// If the file located in Path is moved, removed or truncated by
+// an external program such as logrotate, the file is reopened.
+//
+// The device and inode of Path are checked before each write, or
+// at most once per CheckInterval if it is greater than zero.
+//
+// Reopen can also be called explicitly, e.g. on SIGHUP:
+//
+//	c := make(chan os.Signal, 1)
+//	signal.Notify(c, syscall.SIGHUP)
+//	go func() {
+//		for range c {
+//			hdlr.Reopen()
+//		}
+//	}()
+type WatchedFileHandler struct {
+	logdog.FileHandler
+
+	CheckInterval time.Duration
+
+	lastCheck time.Time
+	size      int64
+	mu        sync.Mutex
+}
+
+// NewWatchedFileHandler returns a new WatchedFileHandler fully initialized
+func NewWatchedFileHandler(options ...logdog.Option) *WatchedFileHandler {
+	hdlr := &WatchedFileHandler{
+		FileHandler: logdog.FileHandler{
+			Output:    logdog.Discard,
+			Level:     logdog.NothingLevel,
+			Formatter: logdog.DefaultFormatter,
+		},
+	}
+
+	hdlr.ApplyOptions(options...)
+
+	return hdlr
+}
+
+// ApplyOptions applys all option to WatchedFileHandler
+func (hdlr *WatchedFileHandler) ApplyOptions(options ...logdog.Option) *WatchedFileHandler {
+	hdlr.FileHandler.ApplyOptions(options...)
+	return hdlr
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (hdlr *WatchedFileHandler) LoadConfig(c map[string]interface{}) error {
+	if err := hdlr.FileHandler.LoadConfig(c); err != nil {
+		return err
+	}
+
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	interval := config.MustGetString("checkInterval", "")
+	if interval != "" {
+		hdlr.CheckInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Emit log record to file, reopen the file before
+// the record is written if it has been changed
+func (hdlr *WatchedFileHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Output == nil || hdlr.Formatter == nil {
+		panic("you should set output and fomatter before use this handler")
+	}
+
+	if hdlr.Filter(record) {
+		return
+	}
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	msg, err := hdlr.Formatter.Format(record)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Format record failed, [%v]\n", err)
+		return
+	}
+
+	if err := hdlr.reopenIfNeeded(); err != nil {
+		fmt.Fprintf(os.Stderr, "Reopen file %s failed, [%v]\n", hdlr.Path, err)
+	}
+
+	fmt.Fprintln(hdlr.Output, msg)
+}
+
+// Reopen closes the current file and reopens the file located in Path,
+// so that the old file descriptor is released
+func (hdlr *WatchedFileHandler) Reopen() error {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+
+	return hdlr.reopen()
+}
+
+// reopenIfNeeded reopens the file if the file located in Path
+// is not the opened one or it has been truncated
+func (hdlr *WatchedFileHandler) reopenIfNeeded() error {
+	if hdlr.Path == "" {
+		return nil
+	}
+
+	now := time.Now()
+	if hdlr.CheckInterval > 0 && now.Sub(hdlr.lastCheck) < hdlr.CheckInterval {
+		return nil
+	}
+	hdlr.lastCheck = now
+
+	pathInfo, err := os.Stat(hdlr.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return hdlr.reopen()
+		}
+		return err
+	}
+
+	file, ok := hdlr.Output.(statter)
+	if !ok {
+		return hdlr.reopen()
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil || !os.SameFile(pathInfo, fileInfo) || fileInfo.Size() < hdlr.size {
+		return hdlr.reopen()
+	}
+	hdlr.size = fileInfo.Size()
+
+	return nil
+}
+
+func (hdlr *WatchedFileHandler) reopen() error {
+	if hdlr.Output != nil {
+		hdlr.Output.Close()
+	}
+	hdlr.size = 0
+
+	file, err := os.OpenFile(hdlr.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		hdlr.Output = logdog.Discard
+		return err
+	}
+	hdlr.Output = file
+
+	if info, err := file.Stat(); err == nil {
+		hdlr.size = info.Size()
+	}
+
+	return nil
+}
+
+func init() {
+	logdog.RegisterConstructor("WatchedFileHandler", func() logdog.ConfigLoader {
+		return NewWatchedFileHandler()
+	})
+}
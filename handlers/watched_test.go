@@ -0,0 +1,96 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+)
+
+func TestWatchedFileHandlerMoved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	hdlr := NewWatchedFileHandler(&logdog.TextFormatter{Fmt: "%(message)"})
+	hdlr.SetPath(path)
+	defer hdlr.Close()
+
+	hdlr.Emit(newRecord("1"))
+	assert.Nil(t, os.Rename(path, path+".1"))
+	hdlr.Emit(newRecord("2"))
+	assert.Nil(t, os.Remove(path))
+	hdlr.Emit(newRecord("3"))
+
+	assert.Equal(t, []string{"1"}, readLines(t, path+".1"))
+	assert.Equal(t, []string{"3"}, readLines(t, path))
+}
+
+func TestWatchedFileHandlerTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	hdlr := NewWatchedFileHandler(&logdog.TextFormatter{Fmt: "%(message)"})
+	hdlr.SetPath(path)
+	defer hdlr.Close()
+
+	hdlr.Emit(newRecord("1"))
+	hdlr.Emit(newRecord("2"))
+	assert.Nil(t, os.Truncate(path, 0))
+	hdlr.Emit(newRecord("3"))
+
+	assert.Equal(t, []string{"3"}, readLines(t, path))
+}
+
+func TestWatchedFileHandlerCheckInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	hdlr := NewWatchedFileHandler(&logdog.TextFormatter{Fmt: "%(message)"})
+	hdlr.CheckInterval = time.Hour
+	hdlr.SetPath(path)
+	defer hdlr.Close()
+
+	hdlr.Emit(newRecord("1"))
+	assert.Nil(t, os.Rename(path, path+".1"))
+	hdlr.Emit(newRecord("2"))
+
+	// the file is not checked until CheckInterval elapses,
+	// Reopen forces it
+	assert.Nil(t, hdlr.Reopen())
+	hdlr.Emit(newRecord("3"))
+
+	assert.Equal(t, []string{"1", "2"}, readLines(t, path+".1"))
+	assert.Equal(t, []string{"3"}, readLines(t, path))
+}
+
+func TestWatchedFileHandlerLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	hdlr := NewWatchedFileHandler()
+	err := hdlr.LoadConfig(logdog.Config{
+		"filename":      path,
+		"checkInterval": "5s",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, hdlr.CheckInterval)
+	assert.Nil(t, hdlr.Close())
+}
+
+func TestWatchedFileHandlerInterface(t *testing.T) {
+	assert.Implements(t, (*logdog.Handler)(nil), NewWatchedFileHandler())
+	assert.Implements(t, (*logdog.ConfigLoader)(nil), NewWatchedFileHandler())
+}
@@ -0,0 +1,38 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+// Package zstd registers the zstd compressor of RetentionPolicy,
+// it is imported for its side effect only:
+//
+//	import _ "github.com/zoumo/logdog/handlers/zstd"
+//
+// Then "zstd" can be used as compression, compressed files are
+// named with .zst extension.
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	handler "github.com/zoumo/logdog/handlers"
+)
+
+func init() {
+	handler.RegisterCompressor("zstd", ".zst", func(w io.Writer) (io.WriteCloser, error) {
+		// segments are compressed one by one in background,
+		// so one goroutine is enough
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	})
+}
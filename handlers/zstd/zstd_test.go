@@ -0,0 +1,51 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package zstd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	handler "github.com/zoumo/logdog/handlers"
+)
+
+func TestRetentionPolicyCompressZstd(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log.1")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\n"), 0660))
+
+	p := &handler.RetentionPolicy{}
+	assert.Nil(t, p.LoadConfig(map[string]interface{}{"compression": "zstd"}))
+	dst, err := p.Compress(path)
+	assert.Nil(t, err)
+	assert.Equal(t, path+".zst", dst)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	file, err := os.Open(dst)
+	assert.Nil(t, err)
+	defer file.Close()
+	r, err := zstd.NewReader(file)
+	assert.Nil(t, err)
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\n", string(data))
+}
@@ -14,7 +14,10 @@
 
 package logdog
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 const (
 	// NothingLevel log level only used in filter
@@ -53,6 +56,72 @@ func (l Level) String() string {
 	return fmt.Sprintf("Level %d", l)
 }
 
+// LevelMask is a set of levels made up of their bit flags,
+// e.g. LevelMask(DebugLevel|NoticeLevel). It lets a handler take exactly
+// the levels in the set, instead of all levels above a threshold.
+// The zero LevelMask means no mask, all levels are taken.
+// Note that LevelMask satisfies the Option interface
+type LevelMask Level
+
+// NewLevelMask returns a LevelMask of levels
+func NewLevelMask(levels ...Level) LevelMask {
+	var m LevelMask
+	for _, level := range levels {
+		m |= LevelMask(level)
+	}
+	return m
+}
+
+// ExceptLevels returns a LevelMask of all levels except levels
+func ExceptLevels(levels ...Level) LevelMask {
+	return LevelMask(AllLevel) &^ NewLevelMask(levels...)
+}
+
+// ParseLevelMask parses level names to LevelMask, a name prefixed
+// with "!" is excluded from the mask. If there are only excluded names,
+// they are excluded from all levels, e.g. ["!INFO"] means all levels except INFO
+func ParseLevelMask(names ...string) (LevelMask, error) {
+	var include, exclude LevelMask
+	for _, name := range names {
+		negative := strings.HasPrefix(name, "!")
+		level := GetLevel(strings.TrimPrefix(name, "!"))
+		if level < 0 {
+			return 0, fmt.Errorf("can not find level: %s", name)
+		}
+		if negative {
+			exclude |= LevelMask(level)
+		} else {
+			include |= LevelMask(level)
+		}
+	}
+
+	if include == 0 && exclude != 0 {
+		include = LevelMask(AllLevel)
+	}
+	return include &^ exclude, nil
+}
+
+// Contains checks if level is in the mask, the zero mask contains all levels
+func (m LevelMask) Contains(level Level) bool {
+	return m == 0 || Level(m)&level != 0
+}
+
+func (m LevelMask) String() string {
+	if m == 0 {
+		return "NOTHING"
+	}
+	if Level(m) == AllLevel {
+		return AllLevel.String()
+	}
+	names := []string{}
+	for bit := DebugLevel; bit <= FatalLevel; bit <<= 1 {
+		if Level(m)&bit != 0 {
+			names = append(names, bit.String())
+		}
+	}
+	return strings.Join(names, "|")
+}
+
 func init() {
 	RegisterLevel("NOTHING", NothingLevel)
 	RegisterLevel("DEBUG", DebugLevel)
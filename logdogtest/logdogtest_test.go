@@ -0,0 +1,104 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdogtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/logdog"
+)
+
+// fakeT records failures and logs instead of reporting them
+type fakeT struct {
+	testing.TB
+	errors []string
+	logs   []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Log(args ...interface{}) {
+	t.logs = append(t.logs, fmt.Sprint(args...))
+}
+
+func (t *fakeT) Cleanup(func()) {}
+
+func TestRecordingHandler(t *testing.T) {
+	logger, hdlr := NewRecordingLogger(logdog.OptionName("recording"))
+
+	logger.Info("started")
+	logger.Error("login failed", logdog.Fields{"user_id": 42})
+	logger.Errorf("login failed for %s", "bob", logdog.Fields{"user_id": int64(7)})
+
+	assert.Equal(t, 3, hdlr.Len())
+	assert.Equal(t, []string{"started", "login failed", "login failed for bob"}, hdlr.Messages())
+
+	hdlr.ExpectCount(t, 1, Level(logdog.ErrorLevel), Field("user_id", 42))
+	hdlr.ExpectCount(t, 2, Name("recording"), MessageContains("login"))
+	hdlr.ExpectSome(t, MinLevel(logdog.WarnLevel))
+	hdlr.ExpectNone(t, Level(logdog.DebugLevel))
+
+	record := hdlr.ExpectOne(t, Message("login failed for bob"))
+	if assert.NotNil(t, record) {
+		assert.Equal(t, int64(7), record.Fields["user_id"])
+	}
+	// values are compared by their string form if types differ
+	assert.Equal(t, 1, hdlr.Count(Field("user_id", "7")))
+	assert.Equal(t, 2, hdlr.Count(HasField("user_id")))
+
+	hdlr.Reset()
+	assert.Equal(t, 0, hdlr.Len())
+}
+
+func TestRecordingHandlerFailure(t *testing.T) {
+	_, hdlr := NewRecordingLogger()
+	ft := &fakeT{}
+
+	assert.False(t, hdlr.ExpectSome(ft, Level(logdog.ErrorLevel)))
+	assert.Equal(t, []string{"expected records with level=ERROR, got none\nno records are stored"}, ft.errors)
+
+	hdlr.Emit(logdog.NewLogRecord("test", logdog.InfoLevel, "test.go", "test.func", 1, "hello", logdog.Fields{"k": "v"}))
+	ft.errors = nil
+	assert.Nil(t, hdlr.ExpectOne(ft, Level(logdog.ErrorLevel), Field("k", "v")))
+	if assert.Len(t, ft.errors, 1) {
+		assert.Equal(t, "expected 1 records with level=ERROR and k=v, got 0\nstored records:\n\t[INFO] test: hello | k=v", ft.errors[0])
+	}
+}
+
+func TestTestHandler(t *testing.T) {
+	ft := &fakeT{}
+	logger := NewTestLogger(ft, logdog.OptionName("test"))
+	logger.Info("to test log")
+
+	if assert.Len(t, ft.logs, 1) {
+		assert.True(t, strings.HasSuffix(ft.logs[0], "to test log"), ft.logs[0])
+	}
+
+	// records are discarded after the test completes
+	hdlr := logger.Handlers[0].(*TestHandler)
+	hdlr.done = true
+	logger.Info("discarded")
+	assert.Len(t, ft.logs, 1)
+
+	// it works with a real testing.T
+	NewTestLogger(t).Info("visible with -v")
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdogtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/zoumo/logdog"
+)
+
+// Matcher checks if a LogRecord matches some condition
+type Matcher struct {
+	desc  string
+	match func(*logdog.LogRecord) bool
+}
+
+// NewMatcher returns a Matcher described by desc
+func NewMatcher(desc string, match func(*logdog.LogRecord) bool) Matcher {
+	return Matcher{desc: desc, match: match}
+}
+
+// Match checks if record matches
+func (m Matcher) Match(record *logdog.LogRecord) bool {
+	return m.match(record)
+}
+
+// String returns the description of Matcher
+func (m Matcher) String() string {
+	return m.desc
+}
+
+// matchAll checks if record matches all matchers
+func matchAll(record *logdog.LogRecord, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m.Match(record) {
+			return false
+		}
+	}
+	return true
+}
+
+// describe joins the descriptions of matchers
+func describe(matchers []Matcher) string {
+	if len(matchers) == 0 {
+		return "any record"
+	}
+	descs := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		descs = append(descs, m.String())
+	}
+	return strings.Join(descs, " and ")
+}
+
+// Level matches records at level
+func Level(level logdog.Level) Matcher {
+	return NewMatcher("level="+level.String(), func(record *logdog.LogRecord) bool {
+		return record.Level == level
+	})
+}
+
+// MinLevel matches records at or above level
+func MinLevel(level logdog.Level) Matcher {
+	return NewMatcher("level>="+level.String(), func(record *logdog.LogRecord) bool {
+		return record.Level >= level
+	})
+}
+
+// Message matches records whose message equals msg
+func Message(msg string) Matcher {
+	return NewMatcher(fmt.Sprintf("message=%q", msg), func(record *logdog.LogRecord) bool {
+		return record.GetMessage() == msg
+	})
+}
+
+// MessageContains matches records whose message contains substr
+func MessageContains(substr string) Matcher {
+	return NewMatcher(fmt.Sprintf("message contains %q", substr), func(record *logdog.LogRecord) bool {
+		return strings.Contains(record.GetMessage(), substr)
+	})
+}
+
+// Name matches records logged by the logger with name
+func Name(name string) Matcher {
+	return NewMatcher(fmt.Sprintf("name=%q", name), func(record *logdog.LogRecord) bool {
+		return record.Name == name
+	})
+}
+
+// HasField matches records with field key
+func HasField(key string) Matcher {
+	return NewMatcher("has field "+key, func(record *logdog.LogRecord) bool {
+		_, ok := record.GetField(key)
+		return ok
+	})
+}
+
+// Field matches records with field key equal to value.
+// Values of different types are equal if they print the same,
+// so that Field("user_id", 42) matches int64(42) too
+func Field(key string, value interface{}) Matcher {
+	return NewMatcher(fmt.Sprintf("%s=%v", key, value), func(record *logdog.LogRecord) bool {
+		v, ok := record.GetField(key)
+		if !ok {
+			return false
+		}
+		return reflect.DeepEqual(v, value) || fmt.Sprint(v) == fmt.Sprint(value)
+	})
+}
@@ -0,0 +1,185 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logdogtest provides handlers and assertions for
+// testing code which logs with logdog.
+package logdogtest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/zoumo/logdog"
+)
+
+// RecordingHandler is a handler which stores every emitted record,
+// records can be asserted by matchers, e.g.
+//
+//	hdlr.ExpectCount(t, 1, logdogtest.Level(logdog.ErrorLevel), logdogtest.Field("user_id", 42))
+type RecordingHandler struct {
+	Name  string
+	Level logdog.Level
+	logdog.Filterer
+
+	records []*logdog.LogRecord
+	mu      sync.Mutex
+}
+
+// NewRecordingHandler returns a new RecordingHandler
+func NewRecordingHandler(options ...logdog.Option) *RecordingHandler {
+	hdlr := &RecordingHandler{
+		Name:  "",
+		Level: logdog.NothingLevel,
+	}
+
+	logdog.ApplyOptionsTo(hdlr, options...)
+
+	return hdlr
+}
+
+// NewRecordingLogger returns a new Logger and its RecordingHandler,
+// the logger is not registered
+func NewRecordingLogger(options ...logdog.Option) (*logdog.Logger, *RecordingHandler) {
+	hdlr := NewRecordingHandler()
+	return logdog.NewLogger(options...).AddHandlers(hdlr), hdlr
+}
+
+// Emit stores log record
+func (hdlr *RecordingHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Filter(record) {
+		return
+	}
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	hdlr.records = append(hdlr.records, record)
+}
+
+// Enabled checks if handler takes records at level
+func (hdlr *RecordingHandler) Enabled(level logdog.Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level)
+}
+
+// Filter checks if handler should filter the specified record
+func (hdlr *RecordingHandler) Filter(record *logdog.LogRecord) bool {
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
+}
+
+// Flush does nothing
+func (hdlr *RecordingHandler) Flush() error {
+	return nil
+}
+
+// Close does nothing, records are kept
+func (hdlr *RecordingHandler) Close() error {
+	return nil
+}
+
+// Records returns all stored records
+func (hdlr *RecordingHandler) Records() []*logdog.LogRecord {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	return append([]*logdog.LogRecord(nil), hdlr.records...)
+}
+
+// Messages returns the messages of all stored records
+func (hdlr *RecordingHandler) Messages() []string {
+	records := hdlr.Records()
+	messages := make([]string, 0, len(records))
+	for _, record := range records {
+		messages = append(messages, record.GetMessage())
+	}
+	return messages
+}
+
+// Len returns the number of stored records
+func (hdlr *RecordingHandler) Len() int {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	return len(hdlr.records)
+}
+
+// Reset removes all stored records
+func (hdlr *RecordingHandler) Reset() {
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	hdlr.records = nil
+}
+
+// Find returns stored records matching all matchers
+func (hdlr *RecordingHandler) Find(matchers ...Matcher) []*logdog.LogRecord {
+	found := []*logdog.LogRecord{}
+	for _, record := range hdlr.Records() {
+		if matchAll(record, matchers) {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// Count returns the number of stored records matching all matchers
+func (hdlr *RecordingHandler) Count(matchers ...Matcher) int {
+	return len(hdlr.Find(matchers...))
+}
+
+// ExpectCount asserts that exactly n stored records match all matchers
+func (hdlr *RecordingHandler) ExpectCount(t testing.TB, n int, matchers ...Matcher) bool {
+	t.Helper()
+	if count := hdlr.Count(matchers...); count != n {
+		t.Errorf("expected %d records with %s, got %d\n%s", n, describe(matchers), count, hdlr.dump())
+		return false
+	}
+	return true
+}
+
+// ExpectOne asserts that exactly one stored record matches all matchers
+// and returns it, returns nil if the assertion fails
+func (hdlr *RecordingHandler) ExpectOne(t testing.TB, matchers ...Matcher) *logdog.LogRecord {
+	t.Helper()
+	if !hdlr.ExpectCount(t, 1, matchers...) {
+		return nil
+	}
+	return hdlr.Find(matchers...)[0]
+}
+
+// ExpectSome asserts that at least one stored record matches all matchers
+func (hdlr *RecordingHandler) ExpectSome(t testing.TB, matchers ...Matcher) bool {
+	t.Helper()
+	if hdlr.Count(matchers...) == 0 {
+		t.Errorf("expected records with %s, got none\n%s", describe(matchers), hdlr.dump())
+		return false
+	}
+	return true
+}
+
+// ExpectNone asserts that no stored record matches all matchers
+func (hdlr *RecordingHandler) ExpectNone(t testing.TB, matchers ...Matcher) bool {
+	t.Helper()
+	return hdlr.ExpectCount(t, 0, matchers...)
+}
+
+// dump prints all stored records for failure messages
+func (hdlr *RecordingHandler) dump() string {
+	records := hdlr.Records()
+	if len(records) == 0 {
+		return "no records are stored"
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "stored records:")
+	for _, record := range records {
+		fmt.Fprintf(buf, "\n\t[%s] %s: %s%s", record.LevelName, record.Name, record.GetMessage(), record.KVString("", ""))
+	}
+	return buf.String()
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdogtest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zoumo/logdog"
+)
+
+// TestHandler is a handler which writes records to testing.T.Log,
+// so that they are attributed to the test and printed only when
+// the test fails or runs with -v.
+//
+// Records emitted after the test completes are discarded.
+type TestHandler struct {
+	Name      string
+	Level     logdog.Level
+	Formatter logdog.Formatter
+	logdog.Filterer
+
+	t    testing.TB
+	done bool
+	mu   sync.Mutex
+}
+
+// NewTestHandler returns a new TestHandler writing to t
+func NewTestHandler(t testing.TB, options ...logdog.Option) *TestHandler {
+	hdlr := &TestHandler{
+		Name:      "",
+		Level:     logdog.NothingLevel,
+		Formatter: logdog.DefaultFormatter,
+		t:         t,
+	}
+
+	logdog.ApplyOptionsTo(hdlr, options...)
+
+	// t.Log panics after the test completes
+	t.Cleanup(func() {
+		hdlr.mu.Lock()
+		defer hdlr.mu.Unlock()
+		hdlr.done = true
+	})
+
+	return hdlr
+}
+
+// NewTestLogger returns a new Logger writing to t, the logger is not registered
+func NewTestLogger(t testing.TB, options ...logdog.Option) *logdog.Logger {
+	return logdog.NewLogger(options...).AddHandlers(NewTestHandler(t))
+}
+
+// Emit log record to t
+func (hdlr *TestHandler) Emit(record *logdog.LogRecord) {
+	if hdlr.Filter(record) {
+		return
+	}
+
+	msg, err := hdlr.Formatter.Format(record)
+	if err != nil {
+		msg = record.GetMessage()
+	}
+
+	hdlr.mu.Lock()
+	defer hdlr.mu.Unlock()
+	if hdlr.done {
+		return
+	}
+	hdlr.t.Log(strings.TrimSuffix(msg, "\n"))
+}
+
+// Enabled checks if handler takes records at level
+func (hdlr *TestHandler) Enabled(level logdog.Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level)
+}
+
+// Filter checks if handler should filter the specified record
+func (hdlr *TestHandler) Filter(record *logdog.LogRecord) bool {
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
+}
+
+// Flush does nothing
+func (hdlr *TestHandler) Flush() error {
+	return nil
+}
+
+// Close does nothing
+func (hdlr *TestHandler) Close() error {
+	return nil
+}
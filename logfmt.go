@@ -0,0 +1,206 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zoumo/logdog/pkg/pythonic"
+	"github.com/zoumo/logdog/pkg/when"
+)
+
+// LogfmtFormatter converts LogRecord to logfmt text like
+//
+//	time=2017-01-02T03:04:05Z level=INFO logger=app caller=main.go:42 msg="hello world" key=value
+//
+// Values containing spaces, quotes, '=' or control characters are quoted
+// and escaped like JSON strings, so the output can be parsed back. Fields
+// are sorted by key and followed by typed fields in order, nested maps and
+// objects are flattened with dotted keys, e.g. user.id=1. Fields named
+// time, level, logger, caller, msg or stack are prefixed with _fields.
+// to not collide with the keys of record.
+type LogfmtFormatter struct {
+	// Datefmt is the strftime format of time, RFC3339 is used if it is empty
+	Datefmt string
+	ConfigLoader
+}
+
+// NewLogfmtFormatter returns a LogfmtFormatter with default config
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{}
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (lf *LogfmtFormatter) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	lf.Datefmt = config.MustGetString("datefmt", "")
+	return nil
+}
+
+// Format converts the specified record to logfmt text
+func (lf *LogfmtFormatter) Format(record *LogRecord) (string, error) {
+	enc := &logfmtEncoder{buf: make([]byte, 0, 256)}
+
+	if lf.Datefmt == "" {
+		enc.addString("time", record.Time.Format(time.RFC3339))
+	} else {
+		enc.addString("time", when.Strftime(&record.Time, lf.Datefmt))
+	}
+	enc.addString("level", record.LevelName)
+	if record.Name != "" {
+		enc.addString("logger", record.Name)
+	}
+	if record.Line > 0 {
+		enc.addString("caller", record.FileName+":"+strconv.Itoa(record.Line))
+	}
+	enc.addString("msg", record.GetMessage())
+
+	eachField(record.Fields, record.TypedFields, func(f Field) {
+		if logfmtKeys[f.Key] {
+			f.Key = defaultFieldsKey + "." + f.Key
+		}
+		enc.AddField(f)
+	})
+
+	if record.Stack != "" {
+		enc.addString("stack", record.Stack)
+	}
+
+	return string(enc.buf), nil
+}
+
+// logfmtKeys are the keys of record written by LogfmtFormatter
+var logfmtKeys = map[string]bool{
+	"time":   true,
+	"level":  true,
+	"logger": true,
+	"caller": true,
+	"msg":    true,
+	"stack":  true,
+}
+
+// logfmtEncoder encodes fields as logfmt key=value pairs,
+// keys of nested objects are prefixed
+type logfmtEncoder struct {
+	buf    []byte
+	prefix string
+}
+
+// AddField encodes f, maps and objects are flattened
+func (enc *logfmtEncoder) AddField(f Field) {
+	switch f.Type {
+	case SkipType:
+		return
+	case ObjectType:
+		nested := &logfmtEncoder{buf: enc.buf, prefix: enc.prefix + f.Key + "."}
+		if err := f.Interface.(ObjectMarshaler).MarshalLogObject(nested); err != nil {
+			nested.AddField(NamedErr("error", err))
+		}
+		enc.buf = nested.buf
+		return
+	case AnyType:
+		if f.Interface == nil {
+			enc.addKey(f.Key)
+			enc.buf = append(enc.buf, "null"...)
+			return
+		}
+		if m, ok := stringMap(f.Interface); ok {
+			enc.addMap(f.Key, m)
+			return
+		}
+		if reflect.TypeOf(f.Interface).Kind() == reflect.Map {
+			// maps with other keys are encoded as JSON
+			enc.addKey(f.Key)
+			enc.buf = appendJSONString(enc.buf, string(f.appendJSON(nil)))
+			return
+		}
+	}
+
+	enc.addKey(f.Key)
+	start := len(enc.buf)
+	enc.buf = f.appendText(enc.buf)
+	if value := string(enc.buf[start:]); needsLogfmtQuote(value) {
+		enc.buf = appendJSONString(enc.buf[:start], value)
+	}
+}
+
+// addMap flattens m sorted by key
+func (enc *logfmtEncoder) addMap(key string, m map[string]interface{}) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	nested := &logfmtEncoder{buf: enc.buf, prefix: enc.prefix + key + "."}
+	for _, k := range keys {
+		nested.AddField(Any(k, m[k]))
+	}
+	enc.buf = nested.buf
+}
+
+func (enc *logfmtEncoder) addString(key, value string) {
+	enc.AddField(String(key, value))
+}
+
+// addKey appends the separator and key=, invalid characters
+// in key are replaced with '_'
+func (enc *logfmtEncoder) addKey(key string) {
+	if len(enc.buf) > 0 {
+		enc.buf = append(enc.buf, ' ')
+	}
+	key = enc.prefix + key
+	if key == "" {
+		key = "_"
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			r = '_'
+		}
+		enc.buf = utf8.AppendRune(enc.buf, r)
+	}
+	enc.buf = append(enc.buf, '=')
+}
+
+// needsLogfmtQuote checks if value must be quoted in logfmt
+func needsLogfmtQuote(value string) bool {
+	if value == "" {
+		return true
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	RegisterConstructor("LogfmtFormatter", func() ConfigLoader {
+		return NewLogfmtFormatter()
+	})
+
+	RegisterFormatter("logfmt", NewLogfmtFormatter())
+}
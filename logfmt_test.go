@@ -0,0 +1,125 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogfmtFormatter(t *testing.T) {
+	record := NewLogRecord("app", InfoLevel, "/path/main.go", "main.main", 42, "hello \"world\"\nbye",
+		Fields{
+			"a":       1,
+			"empty":   "",
+			"eq":      "a=b",
+			"err":     errors.New("boom now"),
+			"nested":  Fields{"b": 2, "a": map[string]interface{}{"c": "d"}},
+			"nil":     nil,
+			"t":       time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+			"d":       time.Second,
+			"bad key": "x",
+			"m":       map[string]int{"x": 1},
+			"ids":     map[int]string{1: "a"},
+		},
+		Object("user", user{1, "jim zhang"}),
+		Any("typed", map[string]bool{"ok": true}),
+	)
+	record.Time = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	text, err := NewLogfmtFormatter().Format(record)
+	assert.Nil(t, err)
+	assert.Equal(t, `time=2017-01-02T03:04:05Z level=INFO logger=app caller=main.go:42 msg="hello \"world\"\nbye" `+
+		`a=1 bad_key=x d=1s empty="" eq="a=b" err="boom now" ids="{\"1\":\"a\"}" m.x=1 nested.a.c=d nested.b=2 nil=null t=2017-01-02T03:04:05Z `+
+		`user.id=1 user.name="jim zhang" typed.ok=true`, text)
+
+	formatter := NewLogfmtFormatter()
+	assert.Nil(t, formatter.LoadConfig(Config{"datefmt": "%Y%m%d"}))
+	record = NewLogRecord("", WarnLevel, "??", "??", 0, "ok")
+	record.Time = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	text, _ = formatter.Format(record)
+	assert.Equal(t, "time=20170102 level=WARN msg=ok", text)
+
+	assert.Implements(t, (*Formatter)(nil), formatter)
+	_, ok := GetFormatter("logfmt").(*LogfmtFormatter)
+	assert.True(t, ok)
+}
+
+func TestLogfmtFormatterRoundTrip(t *testing.T) {
+	msg := "tab\tnul\x00bell\x07del\x7f \"quoted\" back\\slash 中文\u2028"
+	record := NewLogRecord("app", InfoLevel, "/path/main.go", "main.main", 42, "", msg,
+		Fields{"level": "shadowed", "ctrl": "\x1b[31m"},
+		String("msg", "field msg"),
+	)
+	record.Time = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	text, err := NewLogfmtFormatter().Format(record)
+	assert.Nil(t, err)
+	// escaped like JSON instead of Go, e.g. \x00
+	assert.Contains(t, text, `nul\u0000bell\u0007`)
+	assert.Equal(t, map[string]string{
+		"time":          "2017-01-02T03:04:05Z",
+		"level":         "INFO",
+		"logger":        "app",
+		"caller":        "main.go:42",
+		"msg":           msg,
+		"ctrl":          "\x1b[31m",
+		"_fields.level": "shadowed",
+		"_fields.msg":   "field msg",
+	}, parseLogfmt(t, text))
+}
+
+// parseLogfmt parses logfmt text whose quoted values are JSON strings,
+// duplicate keys fail the test
+func parseLogfmt(t *testing.T, text string) map[string]string {
+	result := map[string]string{}
+	for text != "" {
+		i := strings.IndexByte(text, '=')
+		if !assert.True(t, i > 0, text) {
+			return result
+		}
+		key := text[:i]
+		text = text[i+1:]
+
+		var value string
+		if strings.HasPrefix(text, `"`) {
+			end := 1
+			for ; end < len(text) && text[end] != '"'; end++ {
+				if text[end] == '\\' {
+					end++
+				}
+			}
+			assert.Nil(t, json.Unmarshal([]byte(text[:end+1]), &value), text)
+			text = text[end+1:]
+		} else {
+			end := strings.IndexByte(text, ' ')
+			if end < 0 {
+				end = len(text)
+			}
+			value, text = text[:end], text[end:]
+		}
+		text = strings.TrimPrefix(text, " ")
+
+		_, dup := result[key]
+		assert.False(t, dup, "duplicate key %s", key)
+		result[key] = value
+	}
+	return result
+}
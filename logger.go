@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sync"
 
 	"github.com/zoumo/logdog/pkg/pythonic"
 )
@@ -34,6 +35,11 @@ const (
 // logs with colors, but to a file it wouldn't. You can easily implement your
 // own that implements the `Formatter` interface, see the `README` or included
 // formatters for examples.
+//
+// Loggers got by GetLogger form a tree by their dotted names rooted at
+// root, e.g. "app.db" is the parent of "app.db.pool". A logger whose Level is
+// NothingLevel inherits the level of its nearest ancestor, and records are
+// passed to the handlers of ancestors unless Propagate is false.
 type Logger struct {
 	Name     string
 	Handlers []Handler
@@ -42,6 +48,27 @@ type Logger struct {
 	// you should change it if you implement your own log function
 	CallerStackDepth    int
 	EnableRuntimeCaller bool
+	// Propagate decides whether records are passed to
+	// the handlers of ancestors
+	Propagate bool
+	// StackLevel is the level at or above which the stack trace of
+	// logging calls is captured, NothingLevel disables it
+	StackLevel Level
+	// filters are applied only to records logged by this logger,
+	// not to records propagated from descendants
+	Filterer
+
+	// node is shared by copies of the logger,
+	// it is nil if the logger is not registered
+	node *loggerNode
+	// fields are bound by With and merged into every record
+	fields Fields
+}
+
+// loggerNode links a registered logger to its parent
+type loggerNode struct {
+	mu     sync.RWMutex
+	parent *Logger
 }
 
 // NewLogger returns a new Logger
@@ -50,6 +77,7 @@ func NewLogger(options ...Option) *Logger {
 	logger := &Logger{
 		CallerStackDepth:    DefaultCallerStackDepth,
 		EnableRuntimeCaller: true,
+		Propagate:           true,
 	}
 
 	logger.ApplyOptions(options...)
@@ -76,6 +104,8 @@ func (lg *Logger) LoadConfig(c map[string]interface{}) error {
 	lg.Name = config.MustGetString("name", "")
 	lg.Level = GetLevel(config.MustGetString("level", "NOTHING"))
 	lg.EnableRuntimeCaller = config.MustGetBool("enableRuntimeCaller", false)
+	lg.Propagate = config.MustGetBool("propagate", true)
+	lg.StackLevel = GetLevel(config.MustGetString("stackLevel", "NOTHING"))
 
 	_handlers := config.MustGetArray("handlers", make([]interface{}, 0))
 
@@ -87,6 +117,15 @@ func (lg *Logger) LoadConfig(c map[string]interface{}) error {
 		lg.AddHandlers(hdlr)
 	}
 
+	filters, err := LoadFilters(c)
+	if err != nil {
+		return err
+	}
+	lg.AddFilters(filters...)
+	if lg.LevelMask, err = LoadLevelMask(c); err != nil {
+		return err
+	}
+
 	return nil
 
 }
@@ -99,21 +138,113 @@ func (lg *Logger) AddHandlers(handlers ...Handler) *Logger {
 
 // log is the true logging function
 func (lg *Logger) log(level Level, msg string, args ...interface{}) {
+	if !lg.Enabled(level) {
+		return
+	}
+	lg.Handle(lg.makeRecord(level, msg, args...))
+}
+
+// logFields is the true logging function of LogFields,
+// fields are set to the record without being boxed in args
+func (lg *Logger) logFields(level Level, msg string, fields []Field) {
+	if !lg.Enabled(level) {
+		return
+	}
+	record := lg.makeRecord(level, "", msg)
+	record.TypedFields = fields
+	record.Error = findError(nil, fields)
+	lg.Handle(record)
+}
+
+// Enabled checks if a record at level would be handled, it is false if
+// level is filtered by logger's effective level or LevelMask, or no handler
+// of logger and its ancestors takes it. Filters are not checked because
+// they need the record.
+func (lg *Logger) Enabled(level Level) bool {
+	if level < lg.EffectiveLevel() || !lg.LevelMask.Contains(level) {
+		return false
+	}
+	for c := lg; c != nil; c = c.Parent() {
+		for _, hdlr := range c.Handlers {
+			if enabler, ok := hdlr.(LevelEnabler); !ok || enabler.Enabled(level) {
+				return true
+			}
+		}
+		if !c.Propagate {
+			break
+		}
+	}
+	return false
+}
+
+// makeRecord creates a LogRecord with runtime info of the caller
+// and bound fields, it must be called by log functions directly
+func (lg *Logger) makeRecord(level Level, msg string, args ...interface{}) *LogRecord {
 	// 获取runtime的信息
 	file := "??"
 	line := 0
 	funcname := "??"
+	var pc uintptr
 	if lg.EnableRuntimeCaller {
-		if _pc, _file, _line, ok := runtime.Caller(lg.CallerStackDepth); ok {
-			file, line = _file, _line
-			if f := runtime.FuncForPC(_pc); f != nil {
-				funcname = f.Name() // full func name
+		// skip runtime.Callers and makeRecord itself,
+		// pc is a return address like slog.Record.PC
+		pcs := [1]uintptr{}
+		if runtime.Callers(lg.CallerStackDepth+2, pcs[:]) > 0 {
+			frame, _ := runtime.CallersFrames(pcs[:]).Next()
+			pc, file, line = pcs[0], frame.File, frame.Line
+			if frame.Function != "" {
+				funcname = frame.Function // full func name
 			}
 		}
 	}
 
 	record := NewLogRecord(lg.Name, level, file, funcname, line, msg, args...)
-	lg.Handle(record)
+	record.PC = pc
+	if lg.EnableRuntimeCaller {
+		record.Goroutine = goroutineID()
+	}
+	if record.captureStack || (lg.StackLevel != NothingLevel && level >= lg.StackLevel) {
+		// skip makeRecord itself
+		record.Stack = takeStack(lg.CallerStackDepth + 1)
+	}
+	if len(lg.fields) > 0 {
+		record.Fields = lg.mergeFields(record.Fields)
+	}
+	return record
+}
+
+// mergeFields merges fields into the bound fields,
+// fields override bound ones with the same key
+func (lg *Logger) mergeFields(fields Fields) Fields {
+	merged := make(Fields, len(lg.fields)+len(fields))
+	for k, v := range lg.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return merged
+}
+
+// With returns a child logger with fields bound, which are merged
+// into every record logged by it. Fields passed to the logging call
+// override bound ones with the same key.
+//
+// The child has the same name and no handler, its level is inherited from
+// logger and records are propagated to logger, so that it follows changes of
+// logger's level and handlers. Filters of logger are copied to it.
+// It is not registered.
+func (lg *Logger) With(fields Fields) *Logger {
+	return &Logger{
+		Name:                lg.Name,
+		CallerStackDepth:    lg.CallerStackDepth,
+		EnableRuntimeCaller: lg.EnableRuntimeCaller,
+		Propagate:           true,
+		StackLevel:          lg.StackLevel,
+		Filterer:            Filterer{Filters: append([]Filter(nil), lg.Filters...), LevelMask: lg.LevelMask},
+		node:                &loggerNode{parent: lg},
+		fields:              lg.mergeFields(fields),
+	}
 }
 
 // Handle handles the LogRecord, call all halders
@@ -124,18 +255,58 @@ func (lg *Logger) Handle(record *LogRecord) {
 	}
 }
 
+// AddFilters adds filters to logger
+func (lg *Logger) AddFilters(filters ...Filter) *Logger {
+	lg.Filterer.AddFilters(filters...)
+	return lg
+}
+
 // Filter checks if logger should filter the specified record
 func (lg Logger) Filter(record *LogRecord) bool {
-	return record.Level < lg.Level
+	return record.Level < lg.EffectiveLevel() || lg.Filterer.Filter(record)
 }
 
-// CallHandlers call all handler registered in logger
+// CallHandlers call all handler registered in logger,
+// then the handlers of its ancestors until Propagate is false
 func (lg *Logger) callHandlers(record *LogRecord) {
-	for _, hdlr := range lg.Handlers {
-		hdlr.Emit(record)
+	for c := lg; c != nil; c = c.Parent() {
+		for _, hdlr := range c.Handlers {
+			hdlr.Emit(record)
+		}
+		if !c.Propagate {
+			break
+		}
 	}
 }
 
+// Parent returns the parent of logger in the hierarchy,
+// it is nil for root and loggers created by NewLogger
+func (lg Logger) Parent() *Logger {
+	if lg.node == nil {
+		return nil
+	}
+	lg.node.mu.RLock()
+	defer lg.node.mu.RUnlock()
+	return lg.node.parent
+}
+
+func (lg *Logger) setParent(parent *Logger) {
+	lg.node.mu.Lock()
+	defer lg.node.mu.Unlock()
+	lg.node.parent = parent
+}
+
+// EffectiveLevel returns the level of logger, if it is NothingLevel,
+// returns the level of its nearest ancestor whose level is set
+func (lg Logger) EffectiveLevel() Level {
+	for c := &lg; c != nil; c = c.Parent() {
+		if c.Level != NothingLevel {
+			return c.Level
+		}
+	}
+	return NothingLevel
+}
+
 // Flush flushes the file system's in-memory copy to disk
 func (lg *Logger) Flush() error {
 	for _, hdlr := range lg.Handlers {
@@ -235,6 +406,12 @@ func (lg Logger) Fatal(args ...interface{}) {
 	lg.log(FatalLevel, "", args...)
 }
 
+// LogFields emits log message with typed fields, unlike passing
+// them in args of Log, fields are not boxed to interface{}
+func (lg Logger) LogFields(level Level, msg string, fields ...Field) {
+	lg.logFields(level, msg, fields)
+}
+
 // Panic emits log message with FATAL level
 // and panic it
 func (lg Logger) Panic(msg string, args ...interface{}) {
@@ -14,6 +14,7 @@
 package logdog
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -73,3 +74,147 @@ func TestJsonLogger(t *testing.T) {
 func TestLoggerInterface(t *testing.T) {
 	assert.Implements(t, (*ConfigLoader)(nil), NewLogger())
 }
+
+// recordHandler stores emitted records and their messages
+type recordHandler struct {
+	messages []string
+	records  []*LogRecord
+}
+
+func (hdlr *recordHandler) Filter(*LogRecord) bool { return false }
+func (hdlr *recordHandler) Emit(record *LogRecord) {
+	hdlr.messages = append(hdlr.messages, record.GetMessage())
+	hdlr.records = append(hdlr.records, record)
+}
+func (hdlr *recordHandler) Flush() error { return nil }
+func (hdlr *recordHandler) Close() error { return nil }
+
+func TestLoggerLogFields(t *testing.T) {
+	hdlr := &recordHandler{}
+	logger := NewLogger(OptionHandlers(hdlr), OptionEnableRuntimeCaller(true), InfoLevel)
+
+	err := errors.New("boom")
+	logger.LogFields(DebugLevel, "filtered", String("a", "b"))
+	logger.LogFields(InfoLevel, "100% done", String("a", "b"), Err(err))
+
+	assert.Equal(t, []string{"100% done"}, hdlr.messages)
+	record := hdlr.records[0]
+	assert.Equal(t, []Field{String("a", "b"), Err(err)}, record.TypedFields)
+	assert.Equal(t, err, record.Error)
+	assert.Equal(t, "logger_test.go", record.FileName)
+	assert.Equal(t, "TestLoggerLogFields", record.ShortFuncName)
+}
+
+func TestLoggerHierarchy(t *testing.T) {
+	pool := GetLogger("hierarchy.db.pool")
+	app := GetLogger("hierarchy")
+	assert.Equal(t, app, pool.Parent())
+	assert.Equal(t, root, app.Parent())
+	assert.Nil(t, root.Parent())
+	assert.Nil(t, NewLogger().Parent())
+
+	// the new logger in the middle adopts its descendants
+	db := GetLogger("hierarchy.db")
+	assert.Equal(t, db, pool.Parent())
+	assert.Equal(t, app, db.Parent())
+	assert.Equal(t, app, GetLogger("hierarchy.dbx").Parent())
+
+	// level is inherited from the nearest ancestor
+	app.ApplyOptions(WarnLevel)
+	assert.Equal(t, WarnLevel, pool.EffectiveLevel())
+	db.ApplyOptions(DebugLevel)
+	assert.Equal(t, DebugLevel, pool.EffectiveLevel())
+	assert.Equal(t, WarnLevel, app.EffectiveLevel())
+}
+
+func TestLoggerPropagate(t *testing.T) {
+	appHandler, dbHandler := &recordHandler{}, &recordHandler{}
+	app := GetLogger("propagate").AddHandlers(appHandler)
+	app.Propagate = false
+	db := GetLogger("propagate.db").AddHandlers(dbHandler)
+	pool := GetLogger("propagate.db.pool")
+
+	app.ApplyOptions(InfoLevel)
+	pool.Debug("filtered by inherited level")
+	pool.Info("from pool")
+	db.Warn("from db")
+	assert.Equal(t, []string{"from pool", "from db"}, appHandler.messages)
+	assert.Equal(t, []string{"from pool", "from db"}, dbHandler.messages)
+
+	db.Propagate = false
+	pool.Info("stop at db")
+	assert.Equal(t, []string{"from pool", "from db"}, appHandler.messages)
+	assert.Equal(t, []string{"from pool", "from db", "stop at db"}, dbHandler.messages)
+}
+
+func TestLoggerEnabled(t *testing.T) {
+	logger := NewLogger(InfoLevel)
+	assert.False(t, logger.Enabled(ErrorLevel), "no handler")
+
+	logger.AddHandlers(&NullHandler{})
+	assert.False(t, logger.Enabled(ErrorLevel))
+
+	stream := NewStreamHandler(OptionDiscardOutput(), WarnLevel)
+	logger.AddHandlers(stream)
+	assert.False(t, logger.Enabled(DebugLevel), "filtered by logger")
+	assert.False(t, logger.Enabled(InfoLevel), "filtered by handler")
+	assert.True(t, logger.Enabled(WarnLevel))
+
+	stream.LevelMask = NewLevelMask(ErrorLevel)
+	assert.False(t, logger.Enabled(WarnLevel), "filtered by handler's mask")
+	assert.True(t, logger.Enabled(ErrorLevel))
+
+	// handlers which do not implement LevelEnabler take all levels
+	logger.AddHandlers(&recordHandler{})
+	assert.True(t, logger.Enabled(InfoLevel))
+
+	// handlers of ancestors are checked until Propagate is false
+	app := GetLogger("enabled").AddHandlers(NewStreamHandler(OptionDiscardOutput(), ErrorLevel))
+	app.ApplyOptions(DebugLevel)
+	app.Propagate = false
+	child := GetLogger("enabled.child")
+	assert.False(t, child.Enabled(InfoLevel))
+	assert.True(t, child.Enabled(ErrorLevel))
+	child.Propagate = false
+	assert.False(t, child.Enabled(ErrorLevel))
+}
+
+func TestLoggerWith(t *testing.T) {
+	hdlr := &fieldsHandler{}
+	logger := NewLogger(OptionName("with"), OptionHandlers(hdlr), InfoLevel)
+
+	request := logger.With(Fields{"request_id": "abc", "user": "bob"})
+	assert.Equal(t, "with", request.Name)
+	assert.Empty(t, request.Handlers)
+	assert.Equal(t, InfoLevel, request.EffectiveLevel())
+
+	request.Debug("filtered by logger's level")
+	request.Info("bound fields")
+	request.Info("override", Fields{"user": "alice", "n": 1})
+	request.With(Fields{"step": 2}).Infof("nested %d", 2)
+	logger.Info("logger is unchanged")
+
+	assert.Equal(t, []Fields{
+		{"request_id": "abc", "user": "bob"},
+		{"request_id": "abc", "user": "alice", "n": 1},
+		{"request_id": "abc", "user": "bob", "step": 2},
+		nil,
+	}, hdlr.fields)
+
+	// child follows changes of logger
+	logger.ApplyOptions(ErrorLevel)
+	request.Warn("filtered")
+	assert.Len(t, hdlr.fields, 4)
+}
+
+// fieldsHandler stores the fields of emitted records
+type fieldsHandler struct {
+	fields []Fields
+}
+
+func (hdlr *fieldsHandler) Filter(*LogRecord) bool { return false }
+func (hdlr *fieldsHandler) Emit(record *LogRecord) {
+	hdlr.fields = append(hdlr.fields, record.Fields)
+}
+func (hdlr *fieldsHandler) Flush() error { return nil }
+func (hdlr *fieldsHandler) Close() error { return nil }
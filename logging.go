@@ -39,6 +39,11 @@ func ApplyOptions(options ...Option) *Logger {
 	return root
 }
 
+// With is an alias of root.With
+func With(fields Fields) *Logger {
+	return root.With(fields)
+}
+
 // Flush ...
 func Flush() error {
 	return root.Flush()
@@ -120,6 +125,11 @@ func Fatal(args ...interface{}) {
 	root.log(FatalLevel, "", args...)
 }
 
+// LogFields is an alias of root.LogFields
+func LogFields(level Level, msg string, fields ...Field) {
+	root.logFields(level, msg, fields)
+}
+
 // Panic an alias of root.Panic
 func Panic(msg string, args ...interface{}) {
 	root.log(FatalLevel, "", args...)
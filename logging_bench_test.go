@@ -42,3 +42,41 @@ func BenchmarkLogWithFields(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkLogDisabledByLogger(b *testing.B) {
+	logger := createLogger().ApplyOptions(InfoLevel)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Debug("test")
+		}
+	})
+}
+
+func BenchmarkLogDisabledByHandler(b *testing.B) {
+	logger := NewLogger(
+		OptionHandlers(
+			NewStreamHandler(OptionDiscardOutput(), ErrorLevel),
+		),
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Infof("test %s", "disabled")
+		}
+	})
+}
+
+func BenchmarkLogDisabledInHierarchy(b *testing.B) {
+	GetLogger("bench").ApplyOptions(InfoLevel)
+	logger := GetLogger("bench.disabled.child")
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Debug("test")
+		}
+	})
+}
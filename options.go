@@ -48,6 +48,17 @@ func (l Level) applyOption(target interface{}) bool {
 	return false
 }
 
+// makes LevelMask satisfies the Option interface.
+// used in every target which has fields named `LevelMask`
+func (m LevelMask) applyOption(target interface{}) bool {
+	v := reflect.ValueOf(target).Elem()
+	if f := v.FieldByName("LevelMask"); f.IsValid() {
+		f.Set(reflect.ValueOf(m))
+		return true
+	}
+	return false
+}
+
 func (tf *TextFormatter) applyOption(target interface{}) bool {
 	v := reflect.ValueOf(target).Elem()
 	if f := v.FieldByName("Formatter"); f.IsValid() {
@@ -66,6 +77,33 @@ func (fh *JSONFormatter) applyOption(target interface{}) bool {
 	return false
 }
 
+func (lf *LogfmtFormatter) applyOption(target interface{}) bool {
+	v := reflect.ValueOf(target).Elem()
+	if f := v.FieldByName("Formatter"); f.IsValid() {
+		f.Set(reflect.ValueOf(lf))
+		return true
+	}
+	return false
+}
+
+func (ef *ECSFormatter) applyOption(target interface{}) bool {
+	v := reflect.ValueOf(target).Elem()
+	if f := v.FieldByName("Formatter"); f.IsValid() {
+		f.Set(reflect.ValueOf(ef))
+		return true
+	}
+	return false
+}
+
+func (of *OTelFormatter) applyOption(target interface{}) bool {
+	v := reflect.ValueOf(target).Elem()
+	if f := v.FieldByName("Formatter"); f.IsValid() {
+		f.Set(reflect.ValueOf(of))
+		return true
+	}
+	return false
+}
+
 // OptionName is an option
 // used in every target which has fields named `Name`
 func OptionName(name string) Option {
@@ -92,6 +130,19 @@ func OptionCallerStackDepth(depth int) Option {
 	})
 }
 
+// OptionStackLevel is an option.
+// used in every target which has fields named `StackLevel`
+func OptionStackLevel(level Level) Option {
+	return optFuncWraper(func(target interface{}) bool {
+		v := reflect.ValueOf(target).Elem()
+		if f := v.FieldByName("StackLevel"); f.IsValid() {
+			f.Set(reflect.ValueOf(level))
+			return true
+		}
+		return false
+	})
+}
+
 // OptionEnableRuntimeCaller is an option useed in :
 // used in every target which has fields named `EnableRuntimeCaller`
 func OptionEnableRuntimeCaller(enable bool) Option {
@@ -121,6 +172,21 @@ func OptionHandlers(handlers ...Handler) Option {
 	})
 }
 
+// OptionFilters is an option
+// used in every target which has fields named `Filters`
+func OptionFilters(filters ...Filter) Option {
+	return optFuncWraper(func(target interface{}) bool {
+		v := reflect.ValueOf(target).Elem()
+		if f := v.FieldByName("Filters"); f.IsValid() {
+			if f.Kind() == reflect.Slice {
+				f.Set(reflect.ValueOf(filters))
+				return true
+			}
+		}
+		return false
+	})
+}
+
 // OptionOutput is an option
 // used in every target which has fields named `Output`
 func OptionOutput(out io.WriteCloser) Option {
@@ -147,3 +213,12 @@ func OptionDiscardOutput() Option {
 		return false
 	})
 }
+
+// ApplyOptionsTo applys all option to target, target should be a pointer
+// to struct. It is useful when you implement your own handler
+// or formatter outside this package
+func ApplyOptionsTo(target interface{}, options ...Option) {
+	for _, opt := range options {
+		opt.applyOption(target)
+	}
+}
@@ -27,3 +27,9 @@ func TestOptionsInterface(t *testing.T) {
 	assert.Implements(t, (*Option)(nil), OptionOutput(devNull(0)))
 	assert.Implements(t, (*Option)(nil), OptionDiscardOutput())
 }
+
+func TestApplyOptionsTo(t *testing.T) {
+	hdlr := &NullHandler{}
+	ApplyOptionsTo(hdlr, OptionName("null"))
+	assert.Equal(t, "null", hdlr.Name)
+}
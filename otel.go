@@ -0,0 +1,243 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zoumo/logdog/pkg/pythonic"
+)
+
+// OTel SeverityNumber of the first level in each range,
+// see OpenTelemetry log data model
+const (
+	OTelSeverityTrace = 1
+	OTelSeverityDebug = 5
+	OTelSeverityInfo  = 9
+	OTelSeverityWarn  = 13
+	OTelSeverityError = 17
+	OTelSeverityFatal = 21
+)
+
+// ToOTelSeverity converts level to OpenTelemetry SeverityNumber.
+// NoticeLevel is more severe than ErrorLevel in logdog, so it is
+// mapped to ERROR2. Levels between the builtin levels are mapped to
+// the range of the nearest lower builtin level.
+func ToOTelSeverity(level Level) int {
+	switch {
+	case level >= FatalLevel:
+		return OTelSeverityFatal
+	case level >= NoticeLevel:
+		return OTelSeverityError + 1
+	case level >= ErrorLevel:
+		return OTelSeverityError
+	case level >= WarnLevel:
+		return OTelSeverityWarn
+	case level >= InfoLevel:
+		return OTelSeverityInfo
+	case level >= DebugLevel:
+		return OTelSeverityDebug
+	}
+	return OTelSeverityTrace
+}
+
+// OTelFormatter converts LogRecord to JSON in the shape of LogRecord
+// of OTLP/JSON, e.g.
+//
+//	{"timeUnixNano":"1483326245006000000","severityNumber":9,"severityText":"INFO",
+//	 "body":{"stringValue":"hello"},"attributes":[{"key":"code.file.path","value":{...}},...]}
+//
+// Caller, logger name, error and fields are written as attributes,
+// fields with key TraceIDKey and SpanIDKey are written as traceId and spanId.
+type OTelFormatter struct {
+	// TraceIDKey is DefaultTraceIDKey if it is empty
+	TraceIDKey string
+	// SpanIDKey is DefaultSpanIDKey if it is empty
+	SpanIDKey string
+	ConfigLoader
+}
+
+// NewOTelFormatter returns an OTelFormatter with default config
+func NewOTelFormatter() *OTelFormatter {
+	return &OTelFormatter{
+		TraceIDKey: DefaultTraceIDKey,
+		SpanIDKey:  DefaultSpanIDKey,
+	}
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (of *OTelFormatter) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	of.TraceIDKey = config.MustGetString("traceIdKey", DefaultTraceIDKey)
+	of.SpanIDKey = config.MustGetString("spanIdKey", DefaultSpanIDKey)
+	return nil
+}
+
+// otelKeyValue is KeyValue of OTLP/JSON
+type otelKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otelRecord is LogRecord of OTLP/JSON
+type otelRecord struct {
+	TimeUnixNano   string                 `json:"timeUnixNano"`
+	SeverityNumber int                    `json:"severityNumber"`
+	SeverityText   string                 `json:"severityText"`
+	Body           map[string]interface{} `json:"body"`
+	Attributes     []otelKeyValue         `json:"attributes,omitempty"`
+	TraceID        string                 `json:"traceId,omitempty"`
+	SpanID         string                 `json:"spanId,omitempty"`
+}
+
+// Format converts the specified record to OTLP/JSON LogRecord
+func (of *OTelFormatter) Format(record *LogRecord) (string, error) {
+	data := otelRecord{
+		TimeUnixNano:   strconv.FormatInt(record.Time.UnixNano(), 10),
+		SeverityNumber: ToOTelSeverity(record.Level),
+		SeverityText:   record.LevelName,
+		Body:           otelString(record.GetMessage()),
+	}
+
+	enc := &otelEncoder{}
+	if record.Name != "" {
+		enc.AddField(String("logger.name", record.Name))
+	}
+	if record.Line > 0 {
+		enc.AddField(String("code.file.path", record.PathName))
+		enc.AddField(Int("code.line.number", record.Line))
+		enc.AddField(String("code.function.name", record.FuncName))
+	}
+	if err := record.Error; err != nil {
+		enc.AddField(String("exception.message", err.Error()))
+		enc.AddField(String("exception.type", errorType(err)))
+	}
+	if record.Stack != "" {
+		enc.AddField(String("exception.stacktrace", record.Stack))
+	}
+
+	traceIDKey, spanIDKey := traceKeys(of.TraceIDKey, of.SpanIDKey)
+	eachField(record.Fields, record.TypedFields, func(f Field) {
+		switch f.Key {
+		case traceIDKey:
+			data.TraceID = fieldText(f)
+		case spanIDKey:
+			data.SpanID = fieldText(f)
+		default:
+			enc.AddField(f)
+		}
+	})
+	data.Attributes = enc.kvs
+
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("Marashal fields to Json failed, [%v]", err)
+	}
+	return string(jsonBytes), nil
+}
+
+// otelEncoder encodes fields as KeyValue list of OTLP/JSON
+type otelEncoder struct {
+	kvs []otelKeyValue
+}
+
+func (enc *otelEncoder) AddField(f Field) {
+	if f.Type == SkipType {
+		return
+	}
+	enc.kvs = append(enc.kvs, otelKeyValue{Key: f.Key, Value: otelValue(f)})
+}
+
+func otelString(s string) map[string]interface{} {
+	return map[string]interface{}{"stringValue": s}
+}
+
+// otelValue converts the value of f to AnyValue of OTLP/JSON,
+// 64-bit integers are encoded as strings like protobuf JSON mapping
+func otelValue(f Field) map[string]interface{} {
+	switch f.Type {
+	case StringType:
+		return otelString(f.String)
+	case Int64Type:
+		return map[string]interface{}{"intValue": strconv.FormatInt(f.Integer, 10)}
+	case Uint64Type:
+		if f.Integer < 0 {
+			// above math.MaxInt64, it does not fit in intValue
+			return otelString(strconv.FormatUint(uint64(f.Integer), 10))
+		}
+		return map[string]interface{}{"intValue": strconv.FormatInt(f.Integer, 10)}
+	case Float64Type:
+		v := math.Float64frombits(uint64(f.Integer))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			// NaN and Inf are not valid in JSON
+			return otelString(fieldText(f))
+		}
+		return map[string]interface{}{"doubleValue": v}
+	case BoolType:
+		return map[string]interface{}{"boolValue": f.Integer == 1}
+	case TimeType:
+		return otelString(f.time().Format(time.RFC3339Nano))
+	case ObjectType:
+		enc := &otelEncoder{}
+		if err := f.Interface.(ObjectMarshaler).MarshalLogObject(enc); err != nil {
+			enc.AddField(NamedErr("error", err))
+		}
+		return otelKVList(enc.kvs)
+	}
+	if m, ok := stringMap(f.Interface); ok && f.Type == AnyType {
+		return otelMap(m)
+	}
+	return otelString(fieldText(f))
+}
+
+// otelMap converts m to kvlistValue sorted by key
+func otelMap(m map[string]interface{}) map[string]interface{} {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	enc := &otelEncoder{}
+	for _, k := range keys {
+		enc.AddField(Any(k, m[k]))
+	}
+	return otelKVList(enc.kvs)
+}
+
+func otelKVList(kvs []otelKeyValue) map[string]interface{} {
+	if kvs == nil {
+		kvs = []otelKeyValue{}
+	}
+	return map[string]interface{}{"kvlistValue": map[string]interface{}{"values": kvs}}
+}
+
+func init() {
+	RegisterConstructor("OTelFormatter", func() ConfigLoader {
+		return NewOTelFormatter()
+	})
+
+	RegisterFormatter("otel", NewOTelFormatter())
+}
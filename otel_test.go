@@ -0,0 +1,102 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToOTelSeverity(t *testing.T) {
+	assert.Equal(t, 5, ToOTelSeverity(DebugLevel))
+	assert.Equal(t, 9, ToOTelSeverity(InfoLevel))
+	assert.Equal(t, 13, ToOTelSeverity(WarnLevel))
+	assert.Equal(t, 17, ToOTelSeverity(ErrorLevel))
+	assert.Equal(t, 18, ToOTelSeverity(NoticeLevel))
+	assert.Equal(t, 21, ToOTelSeverity(FatalLevel))
+	assert.Equal(t, 21, ToOTelSeverity(FatalLevel+10))
+	assert.Equal(t, 9, ToOTelSeverity(InfoLevel+1))
+	assert.Equal(t, 1, ToOTelSeverity(NothingLevel))
+}
+
+func TestOTelValueUint64(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{"intValue": "9223372036854775807"},
+		otelValue(Uint64("u", math.MaxInt64)))
+	// intValue is a signed 64-bit integer
+	assert.Equal(t, map[string]interface{}{"stringValue": "18446744073709551615"},
+		otelValue(Uint64("u", math.MaxUint64)))
+	assert.Equal(t, map[string]interface{}{"stringValue": "9223372036854775808"},
+		otelValue(Uint64("u", math.MaxInt64+1)))
+}
+
+func TestOTelFormatter(t *testing.T) {
+	record := NewLogRecord("app", ErrorLevel, "/path/main.go", "main.main", 42, "hello",
+		Fields{
+			"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+			"span_id":  "00f067aa0ba902b7",
+			"nested":   Fields{"b": true, "a": "x"},
+			"m":        map[string]int{"x": 1},
+		},
+		Int64("n", 1),
+		Float64("f", 1.5),
+		Float64("nan", math.NaN()),
+		Time("t", time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)),
+		Object("user", user{1, "jim"}),
+		Err(errors.New("boom")),
+	)
+	record.Time = time.Unix(1483326245, 6000000)
+
+	text, err := NewOTelFormatter().Format(record)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"timeUnixNano":"1483326245006000000","severityNumber":17,"severityText":"ERROR",`+
+		`"body":{"stringValue":"hello"},"attributes":[`+
+		`{"key":"logger.name","value":{"stringValue":"app"}},`+
+		`{"key":"code.file.path","value":{"stringValue":"/path/main.go"}},`+
+		`{"key":"code.line.number","value":{"intValue":"42"}},`+
+		`{"key":"code.function.name","value":{"stringValue":"main.main"}},`+
+		`{"key":"exception.message","value":{"stringValue":"boom"}},`+
+		`{"key":"exception.type","value":{"stringValue":"*errors.errorString"}},`+
+		`{"key":"m","value":{"kvlistValue":{"values":[{"key":"x","value":{"intValue":"1"}}]}}},`+
+		`{"key":"nested","value":{"kvlistValue":{"values":[`+
+		`{"key":"a","value":{"stringValue":"x"}},{"key":"b","value":{"boolValue":true}}]}}},`+
+		`{"key":"n","value":{"intValue":"1"}},`+
+		`{"key":"f","value":{"doubleValue":1.5}},`+
+		`{"key":"nan","value":{"stringValue":"NaN"}},`+
+		`{"key":"t","value":{"stringValue":"2017-01-02T03:04:05Z"}},`+
+		`{"key":"user","value":{"kvlistValue":{"values":[`+
+		`{"key":"id","value":{"intValue":"1"}},{"key":"name","value":{"stringValue":"jim"}}]}}},`+
+		`{"key":"error","value":{"stringValue":"boom"}}],`+
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7"}`, text)
+
+	formatter := NewOTelFormatter()
+	assert.Nil(t, formatter.LoadConfig(Config{"spanIdKey": "span"}))
+	record = NewLogRecord("", NoticeLevel, "??", "??", 0, "ok", Fields{"span": "abc"})
+	text, _ = formatter.Format(record)
+	var data map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(text), &data))
+	assert.Equal(t, "abc", data["spanId"])
+	assert.Equal(t, float64(18), data["severityNumber"])
+	assert.NotContains(t, data, "attributes")
+	assert.NotContains(t, data, "traceId")
+
+	assert.Implements(t, (*Formatter)(nil), formatter)
+	_, ok := GetFormatter("otel").(*OTelFormatter)
+	assert.True(t, ok)
+}
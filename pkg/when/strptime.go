@@ -0,0 +1,146 @@
+package when
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Strptime parses value according to the directives in the given format string,
+// it is the inverse of Strftime. Supported directives are
+// %Y %y %m %d %H %I %M %S %f %j %p %a %A %b %B and %%, names are matched
+// case-insensitively and weekdays are checked but not used, like python.
+// The result is in the given location.
+func Strptime(value, f string, loc *time.Location) (time.Time, error) {
+	var (
+		year   = 1900
+		month  = 1
+		day    = 1
+		hour   = 0
+		minute = 0
+		second = 0
+		micro  = 0
+		yday   = -1
+		hour12 = -1
+		pm     = false
+	)
+
+	str := []rune(value)
+	format := []rune(f)
+	j := 0
+
+	digits := func(width int) (int, error) {
+		if j+width > len(str) {
+			return 0, fmt.Errorf("value %q is too short for format %q", value, f)
+		}
+		n := 0
+		for _, r := range str[j : j+width] {
+			if r < '0' || r > '9' {
+				return 0, fmt.Errorf("value %q does not match format %q", value, f)
+			}
+			n = n*10 + int(r-'0')
+		}
+		j += width
+		return n, nil
+	}
+
+	// name returns the index of the name matching str at j
+	name := func(names []string) (int, error) {
+		rest := string(str[j:])
+		for i, n := range names {
+			if n != "---" && len(rest) >= len(n) && strings.EqualFold(rest[:len(n)], n) {
+				j += len([]rune(n))
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("value %q does not match format %q", value, f)
+	}
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			if j >= len(str) || str[j] != format[i] {
+				return time.Time{}, fmt.Errorf("value %q does not match format %q", value, f)
+			}
+			j++
+			continue
+		}
+
+		i++
+		var err error
+		switch format[i] {
+		case 'Y':
+			year, err = digits(4)
+		case 'y':
+			year, err = digits(2)
+			// the same pivot as python, 69-99 => 1969-1999, 0-68 => 2000-2068
+			if year < 69 {
+				year += 2000
+			} else {
+				year += 1900
+			}
+		case 'm':
+			month, err = digits(2)
+		case 'd':
+			day, err = digits(2)
+		case 'H':
+			hour, err = digits(2)
+		case 'I':
+			hour12, err = digits(2)
+			if err == nil && (hour12 < 1 || hour12 > 12) {
+				err = fmt.Errorf("value %q is out of range for format %q", value, f)
+			}
+		case 'p':
+			var i int
+			i, err = name([]string{"AM", "PM"})
+			pm = i == 1
+		case 'a':
+			_, err = name(shortDayNames)
+		case 'A':
+			_, err = name(longDayNames)
+		case 'b':
+			month, err = name(shortMonthNames)
+		case 'B':
+			month, err = name(longMonthNames)
+		case 'M':
+			minute, err = digits(2)
+		case 'S':
+			second, err = digits(2)
+		case 'f':
+			micro, err = digits(6)
+		case 'j':
+			yday, err = digits(3)
+		case '%':
+			if j >= len(str) || str[j] != '%' {
+				err = fmt.Errorf("value %q does not match format %q", value, f)
+			}
+			j++
+		default:
+			err = fmt.Errorf("unsupported directive %%%c in format %q", format[i], f)
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if j != len(str) {
+		return time.Time{}, fmt.Errorf("unconverted data remains: %q", string(str[j:]))
+	}
+
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 60 {
+		return time.Time{}, fmt.Errorf("value %q is out of range for format %q", value, f)
+	}
+
+	if hour12 >= 0 {
+		// %I without %p is AM
+		hour = hour12 % 12
+		if pm {
+			hour += 12
+		}
+	}
+
+	if yday > 0 {
+		month, day = 1, yday
+	}
+
+	return time.Date(year, time.Month(month), day, hour, minute, second, micro*1000, loc), nil
+}
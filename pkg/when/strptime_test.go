@@ -0,0 +1,51 @@
+package when
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStrptime(t *testing.T) {
+	date := time.Date(2005, 2, 3, 4, 5, 6, 7000, time.UTC)
+	format := "%Y-%m-%d_%H-%M-%S.%f %%"
+	result, err := Strptime(Strftime(&date, format), format, time.UTC)
+	AssertEqual(t, err, nil)
+	AssertEqual(t, result, date)
+
+	result, err = Strptime("89 365", "%y %j", time.UTC)
+	AssertEqual(t, err, nil)
+	AssertEqual(t, result, time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC))
+
+	result, err = Strptime("2016-11-01", "%Y-%m-%d", time.Local)
+	AssertEqual(t, err, nil)
+	AssertEqual(t, result, time.Date(2016, 11, 1, 0, 0, 0, 0, time.Local))
+
+	for _, value := range []string{"2016-11", "2016-11-01.gz", "2016-1x-01", "2016-13-01"} {
+		_, err = Strptime(value, "%Y-%m-%d", time.UTC)
+		if err == nil {
+			t.Error("Expected error for ", value)
+		}
+	}
+
+	result, err = Strptime("Thu 23-nov-2017 01PM", "%a %d-%b-%Y %I%p", time.UTC)
+	AssertEqual(t, err, nil)
+	AssertEqual(t, result, time.Date(2017, 11, 23, 13, 0, 0, 0, time.UTC))
+
+	date = time.Date(2017, 9, 3, 0, 30, 0, 0, time.UTC)
+	format = "%A %d %B %Y %I:%M %p"
+	result, err = Strptime(Strftime(&date, format), format, time.UTC)
+	AssertEqual(t, err, nil)
+	AssertEqual(t, result, date)
+
+	for _, value := range []string{"Thx 23-Nov-2017 01PM", "Thu 23-Nox-2017 01PM", "Thu 23-Nov-2017 13PM", "Thu 23-Nov-2017 01XM"} {
+		_, err = Strptime(value, "%a %d-%b-%Y %I%p", time.UTC)
+		if err == nil {
+			t.Error("Expected error for ", value)
+		}
+	}
+
+	_, err = Strptime("47", "%U", time.UTC)
+	if err == nil {
+		t.Error("Expected error for unsupported directive")
+	}
+}
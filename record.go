@@ -15,9 +15,13 @@
 package logdog
 
 import (
+	"bytes"
 	"fmt"
+	"os"
 	"path"
-	"sort"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -40,37 +44,27 @@ func (f Fields) String() string {
 
 // ToKVString convert Fields to string likes k1=v1 k2=v2
 func (f Fields) ToKVString(color, endColor string) string {
+	return kvString(f, nil, color, endColor)
+}
 
-	if len(f) == 0 {
+// kvString converts fields and typed fields to string likes
+// k1=v1 k2=v2, typed fields follow fields in order
+func kvString(fields Fields, typed []Field, color, endColor string) string {
+	if len(fields) == 0 && len(typed) == 0 {
 		return ""
 	}
 
-	b := &buffer{}
-	fmt.Fprint(b, " | ")
-
-	sorted := make([]string, 0, len(f))
-	for k := range f {
-		sorted = append(sorted, k)
+	enc := &fieldEncoder{
+		buf:      []byte(" | "),
+		color:    color,
+		endColor: endColor,
 	}
-	sort.Strings(sorted)
-
-	first := true
-	for _, k := range sorted {
-		v := f[k]
-		// auto format time to RFC3339
-		if vv, ok := v.(time.Time); ok {
-			v = vv.Format(time.RFC3339)
-		}
-
-		if first {
-			fmt.Fprintf(b, "%s=%s%+v%s", k, color, v, endColor)
-			first = false
-		} else {
-			fmt.Fprintf(b, " %s=%s%+v%s", k, color, v, endColor)
-		}
+	enc.encode(fields, typed)
+	if enc.count == 0 {
+		return ""
 	}
 
-	return string(*b)
+	return string(enc.buf)
 }
 
 // LogRecord defines a real log record should be
@@ -82,13 +76,39 @@ type LogRecord struct {
 	FileName      string
 	FuncName      string
 	ShortFuncName string
-	Line          int
-	Time          time.Time
+	// Module is the filename without extension
+	Module string
+	// Package is the import path of the package of caller
+	Package string
+	Line    int
+	// PC is the program counter of the logging call,
+	// it is 0 if runtime caller is disabled
+	PC   uintptr
+	Time time.Time
 	// msg could be ""
 	Msg  string
 	Args []interface{}
 	// extract fields from args
 	Fields Fields
+	// extract typed fields from args, in the order they are passed
+	TypedFields []Field
+	// Error is the first error in args or typed fields, its chain
+	// is walked by formatters
+	Error error
+	// Stack is the stack trace of the logging call, it is empty
+	// unless the logger is asked to capture it
+	Stack string
+
+	// Process, ProcessName and Hostname tell where the record is created
+	Process     int
+	ProcessName string
+	Hostname    string
+	// Goroutine is the ID of goroutine calling the logging function,
+	// it is 0 if runtime caller is disabled
+	Goroutine int
+
+	// captureStack is true if WithStack is in args
+	captureStack bool
 }
 
 // NewLogRecord returns a new log record
@@ -101,6 +121,10 @@ func NewLogRecord(name string, level Level, pathname string, funcname string, li
 		Msg:      msg,
 		Args:     args,
 		Time:     time.Now(),
+
+		Process:     pid,
+		ProcessName: processName,
+		Hostname:    hostname,
 	}
 	// level name
 	record.LevelName = level.String()
@@ -108,15 +132,21 @@ func NewLogRecord(name string, level Level, pathname string, funcname string, li
 	// file name
 	_, filename := path.Split(pathname)
 	record.FileName = filename
+	record.Module = strings.TrimSuffix(filename, path.Ext(filename))
 
 	// func name
 	i := strings.LastIndex(funcname, "/")
 	record.FuncName = funcname[i+1:]
 	j := strings.LastIndex(funcname[i+1:], ".")
 	record.ShortFuncName = record.FuncName[j+1:]
+	record.Package = funcname
+	if k := strings.Index(record.FuncName, "."); k >= 0 {
+		record.Package = funcname[:i+1+k]
+	}
 
 	// split args and fields
 	record.ExtractFieldsFromArgs()
+	record.Error = findError(record.Args, record.TypedFields)
 
 	return &record
 }
@@ -124,6 +154,12 @@ func NewLogRecord(name string, level Level, pathname string, funcname string, li
 // GetMessage formats record message by msg and args
 func (lr LogRecord) GetMessage() string {
 	msg := lr.Msg
+	if msg == "" && len(lr.Args) == 1 {
+		// fast path of Info("msg"), the same as Sprintln without newline
+		if s, ok := lr.Args[0].(string); ok {
+			return s
+		}
+	}
 	buf := &buffer{}
 	if msg == "" {
 		fmt.Fprintln(buf, lr.Args...)
@@ -135,17 +171,198 @@ func (lr LogRecord) GetMessage() string {
 	return msg
 }
 
-// ExtractFieldsFromArgs extracts fields (Fields) from args
-// Fields must be the last element in args
+// ExtractFieldsFromArgs extracts fields (Fields), typed fields (Field)
+// and WithStack from args, they must be at the end of args
 func (lr *LogRecord) ExtractFieldsFromArgs() {
-	argsLen := len(lr.Args)
-	if argsLen == 0 {
+	end := len(lr.Args)
+	for end > 0 && isField(lr.Args[end-1]) {
+		end--
+	}
+	if end == len(lr.Args) {
 		return
 	}
 
-	if fields, ok := lr.Args[argsLen-1].(Fields); ok {
-		lr.Args = lr.Args[:argsLen-1]
-		lr.Fields = fields
+	for _, arg := range lr.Args[end:] {
+		switch v := arg.(type) {
+		case Field:
+			if lr.TypedFields == nil {
+				lr.TypedFields = make([]Field, 0, len(lr.Args)-end)
+			}
+			lr.TypedFields = append(lr.TypedFields, v)
+		case Fields:
+			if lr.Fields == nil {
+				lr.Fields = v
+				continue
+			}
+			// do not modify the Fields passed in
+			merged := make(Fields, len(lr.Fields)+len(v))
+			for k, vv := range lr.Fields {
+				merged[k] = vv
+			}
+			for k, vv := range v {
+				merged[k] = vv
+			}
+			lr.Fields = merged
+		case stackMarker:
+			lr.captureStack = true
+		}
+	}
+	lr.Args = lr.Args[:end]
+}
+
+func isField(arg interface{}) bool {
+	switch arg.(type) {
+	case Field, Fields, stackMarker:
+		return true
+	}
+	return false
+}
+
+// GetField returns the value of field key, typed fields
+// override Fields with the same key
+func (lr *LogRecord) GetField(key string) (interface{}, bool) {
+	for i := len(lr.TypedFields) - 1; i >= 0; i-- {
+		f := lr.TypedFields[i]
+		if f.Key == key && f.Type != SkipType {
+			return f.Value(), true
+		}
+	}
+	v, ok := lr.Fields[key]
+	return v, ok
+}
+
+// AllFields returns Fields and values of typed fields in one Fields,
+// typed fields override Fields with the same key.
+// Fields is returned directly if there is no typed field.
+func (lr *LogRecord) AllFields() Fields {
+	if len(lr.TypedFields) == 0 {
+		return lr.Fields
+	}
+	fields := make(Fields, len(lr.Fields)+len(lr.TypedFields))
+	for k, v := range lr.Fields {
+		fields[k] = v
+	}
+	for _, f := range lr.TypedFields {
+		if f.Type != SkipType {
+			fields[f.Key] = f.Value()
+		}
+	}
+	return fields
+}
+
+// KVString converts Fields and typed fields of record to string
+// likes k1=v1 k2=v2, typed fields follow Fields in order
+func (lr *LogRecord) KVString(color, endColor string) string {
+	return kvString(lr.Fields, lr.TypedFields, color, endColor)
+}
+
+// Created returns the creation time of record in seconds since the epoch
+func (lr *LogRecord) Created() float64 {
+	return float64(lr.Time.UnixNano()) / float64(time.Second)
+}
+
+// Msecs returns the millisecond portion of the creation time of record
+func (lr *LogRecord) Msecs() int {
+	return lr.Time.Nanosecond() / int(time.Millisecond)
+}
+
+// RelativeCreated returns the creation time of record in milliseconds
+// relative to the time when the program starts
+func (lr *LogRecord) RelativeCreated() float64 {
+	return float64(lr.Time.Sub(startTime)) / float64(time.Millisecond)
+}
+
+// attrKind is the kind of value of a record attribute
+type attrKind int
+
+const (
+	stringAttr attrKind = iota
+	intAttr
+	floatAttr
+)
+
+// recordAttributes are the attributes returned by LogRecord.Attribute,
+// they are named after python's LogRecord attributes
+var recordAttributes = map[string]attrKind{
+	"name":            stringAttr,
+	"levelno":         intAttr,
+	"levelname":       stringAttr,
+	"pathname":        stringAttr,
+	"filename":        stringAttr,
+	"module":          stringAttr,
+	"package":         stringAttr,
+	"funcname":        stringAttr,
+	"lineno":          intAttr,
+	"created":         floatAttr,
+	"msecs":           intAttr,
+	"relativeCreated": floatAttr,
+	"process":         intAttr,
+	"processName":     stringAttr,
+	"hostname":        stringAttr,
+	"goroutine":       intAttr,
+	"thread":          intAttr,
+	"message":         stringAttr,
+}
+
+// Attribute returns the value of record attribute by python's name, e.g.
+// levelname, lineno, relativeCreated. %(thread) is the goroutine ID, since
+// goroutines are what threads are in python.
+// ok is false if name is unknown.
+func (lr *LogRecord) Attribute(name string) (value interface{}, ok bool) {
+	switch name {
+	case "name":
+		return lr.Name, true
+	case "levelno":
+		return int(lr.Level), true
+	case "levelname":
+		return lr.LevelName, true
+	case "pathname":
+		return lr.PathName, true
+	case "filename":
+		return lr.FileName, true
+	case "module":
+		return lr.Module, true
+	case "package":
+		return lr.Package, true
+	case "funcname":
+		return lr.ShortFuncName, true
+	case "lineno":
+		return lr.Line, true
+	case "created":
+		return lr.Created(), true
+	case "msecs":
+		return lr.Msecs(), true
+	case "relativeCreated":
+		return lr.RelativeCreated(), true
+	case "process":
+		return lr.Process, true
+	case "processName":
+		return lr.ProcessName, true
+	case "hostname":
+		return lr.Hostname, true
+	case "goroutine", "thread":
+		return lr.Goroutine, true
+	case "message":
+		return lr.GetMessage(), true
 	}
+	return nil, false
+}
 
+var (
+	startTime   = time.Now()
+	pid         = os.Getpid()
+	processName = filepath.Base(os.Args[0])
+	hostname, _ = os.Hostname()
+)
+
+// goroutineID returns the ID of current goroutine parsed
+// from the header of its stack trace, e.g. "goroutine 18 [running]:"
+func goroutineID() int {
+	buf := [64]byte{}
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.Atoi(string(b))
+	return id
 }
@@ -15,6 +15,8 @@ package logdog
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -55,3 +57,38 @@ func TestLogRecordError(t *testing.T) {
 	assert.Nil(t, record.Fields)
 
 }
+
+func TestLogRecordAttribute(t *testing.T) {
+	record := NewLogRecord(name, level, "/go/src/app/main.go", "github.com/zoumo/logdog.(*Logger).Info", line, "msg")
+	assert.Equal(t, "main", record.Module)
+	assert.Equal(t, "github.com/zoumo/logdog", record.Package)
+	assert.Equal(t, os.Getpid(), record.Process)
+	assert.Equal(t, filepath.Base(os.Args[0]), record.ProcessName)
+	assert.True(t, record.RelativeCreated() > 0)
+
+	for attr := range recordAttributes {
+		_, ok := record.Attribute(attr)
+		assert.True(t, ok, attr)
+	}
+	_, ok := record.Attribute("unknown")
+	assert.False(t, ok)
+
+	record = NewLogRecord(name, level, pathname, "main.main", line, "msg")
+	assert.Equal(t, "main", record.Package)
+
+	// goroutine is captured by logger with runtime caller enabled
+	hdlr := &recordHandler{}
+	logger := NewLogger(OptionHandlers(hdlr))
+	logger.Info("main")
+	done := make(chan struct{})
+	go func() {
+		logger.Info("another goroutine")
+		close(done)
+	}()
+	<-done
+	assert.NotZero(t, hdlr.records[0].Goroutine)
+	assert.NotZero(t, hdlr.records[1].Goroutine)
+	assert.NotEqual(t, hdlr.records[0].Goroutine, hdlr.records[1].Goroutine)
+	thread, _ := hdlr.records[0].Attribute("thread")
+	assert.Equal(t, goroutineID(), thread)
+}
@@ -14,7 +14,11 @@
 
 package logdog
 
-import "github.com/zoumo/register"
+import (
+	"strings"
+
+	"github.com/zoumo/register"
+)
 
 var (
 	formatters   = register.NewRegister(nil)
@@ -22,6 +26,8 @@ var (
 	constructors = register.NewRegister(nil)
 	loggers      = register.NewRegister(nil)
 	levels       = register.NewRegister(nil)
+	extractors   = register.NewRegister(nil)
+	filters      = register.NewRegister(nil)
 )
 
 // Constructor is a function which returns an ConfigLoader
@@ -56,6 +62,20 @@ func GetFormatter(name string) Formatter {
 	return v.(Formatter)
 }
 
+// RegisterFilter binds name and Filter
+func RegisterFilter(name string, filter Filter) {
+	filters.Register(name, filter)
+}
+
+// GetFilter returns a Filter registered with the given name
+func GetFilter(name string) Filter {
+	v, ok := filters.Get(name)
+	if !ok {
+		return nil
+	}
+	return v.(Filter)
+}
+
 // RegisterHandler binds name and Handler
 func RegisterHandler(name string, handler Handler) {
 	handlers.Register(name, handler)
@@ -71,7 +91,11 @@ func GetHandler(name string) Handler {
 }
 
 // GetLogger returns an logger by name
-// if not, create one and add it to logger register
+// if not, create one and add it to logger register.
+//
+// The logger is linked into the hierarchy by its dotted name, its parent is
+// the nearest registered ancestor, e.g. "app" for "app.db.pool" if "app.db"
+// is not registered, or root. Registered descendants are relinked to it.
 func GetLogger(name string, options ...Option) *Logger {
 	if name == "" {
 		name = RootLoggerName
@@ -84,6 +108,10 @@ func GetLogger(name string, options ...Option) *Logger {
 
 	options = append(options, OptionName(name))
 	logger := NewLogger(options...)
+	logger.node = &loggerNode{}
+
+	mu.Lock()
+	defer mu.Unlock()
 
 	// check twice
 	// maybe sb. adds logger when this logger is creating
@@ -93,9 +121,59 @@ func GetLogger(name string, options ...Option) *Logger {
 	}
 
 	loggers.Register(name, logger)
+	linkLogger(name, logger)
 	return logger
 }
 
+// linkLogger sets the parent of logger and relinks its descendants,
+// mu must be held
+func linkLogger(name string, logger *Logger) {
+	if name == RootLoggerName {
+		return
+	}
+
+	logger.setParent(ancestorLogger(name))
+
+	prefix := name + "."
+	for key, v := range snapshotLoggers() {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		// the current parent of descendant is above logger
+		descendant := v.(*Logger)
+		if parent := descendant.Parent(); parent == nil || !strings.HasPrefix(parent.Name, prefix) {
+			descendant.setParent(logger)
+		}
+	}
+}
+
+// ancestorLogger returns the nearest registered ancestor of name,
+// or root if there is none
+func ancestorLogger(name string) *Logger {
+	for i := strings.LastIndex(name, "."); i > 0; i = strings.LastIndex(name, ".") {
+		name = name[:i]
+		if v, ok := loggers.Get(name); ok {
+			return v.(*Logger)
+		}
+	}
+	if v, ok := loggers.Get(RootLoggerName); ok {
+		return v.(*Logger)
+	}
+	return nil
+}
+
+// snapshotLoggers returns a copy of registered loggers
+func snapshotLoggers() map[string]interface{} {
+	loggers.Lock()
+	defer loggers.Unlock()
+
+	snapshot := make(map[string]interface{}, len(loggers.Iter()))
+	for k, v := range loggers.Iter() {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
 // GetLevel returns a Level registered with the given name
 func GetLevel(name string) Level {
 	v, ok := levels.Get(name)
@@ -0,0 +1,346 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/zoumo/logdog/pkg/pythonic"
+)
+
+// ToSlogLevel maps level to slog.Level.
+//
+// NoticeLevel is above ErrorLevel in logdog, so it is mapped to
+// slog.LevelError+2 and FatalLevel to slog.LevelError+4,
+// FromSlogLevel maps them back.
+func ToSlogLevel(level Level) slog.Level {
+	switch {
+	case level <= DebugLevel:
+		return slog.LevelDebug
+	case level <= InfoLevel:
+		return slog.LevelInfo
+	case level <= WarnLevel:
+		return slog.LevelWarn
+	case level <= ErrorLevel:
+		return slog.LevelError
+	case level <= NoticeLevel:
+		return slog.LevelError + 2
+	}
+	return slog.LevelError + 4
+}
+
+// FromSlogLevel maps slog.Level to Level, levels between
+// slog's levels are rounded down, e.g. slog.LevelInfo+2 is InfoLevel
+func FromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	case level < slog.LevelError+2:
+		return ErrorLevel
+	case level < slog.LevelError+4:
+		return NoticeLevel
+	}
+	return FatalLevel
+}
+
+// SlogAdapter implements slog.Handler on top of a Logger, so that
+// code using log/slog logs through logdog's handlers.
+//
+// Attrs are converted to Fields, attrs in groups are keyed by
+// the dotted path, e.g. slog.Group("req", "id", 1) is req.id=1.
+// Records are handled as if they were logged by the Logger,
+// so its level, filters, bound fields and handlers all apply.
+type SlogAdapter struct {
+	logger *Logger
+	fields Fields
+	prefix string
+}
+
+// NewSlogAdapter returns a SlogAdapter logging to logger
+func NewSlogAdapter(logger *Logger) *SlogAdapter {
+	return &SlogAdapter{logger: logger}
+}
+
+// NewSlogLogger returns a slog.Logger logging to logger
+func NewSlogLogger(logger *Logger) *slog.Logger {
+	return slog.New(NewSlogAdapter(logger))
+}
+
+// Enabled reports whether the logger handles records at level
+func (a *SlogAdapter) Enabled(_ context.Context, level slog.Level) bool {
+	return a.logger.Enabled(FromSlogLevel(level))
+}
+
+// Handle converts r to LogRecord and handles it by the logger.
+// Fields extracted from ctx are overridden by bound fields of
+// the logger, attrs of the adapter and attrs of r in order.
+func (a *SlogAdapter) Handle(ctx context.Context, r slog.Record) error {
+	lg := a.logger
+
+	file := "??"
+	line := 0
+	funcname := "??"
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		file, line, funcname = frame.File, frame.Line, frame.Function
+	}
+
+	// the message is formatted, keep it away from Sprintf
+	record := NewLogRecord(lg.Name, FromSlogLevel(r.Level), file, funcname, line, "", r.Message)
+	record.PC = r.PC
+	if !r.Time.IsZero() {
+		record.Time = r.Time
+	}
+
+	fields := ExtractFields(ctx)
+	if fields == nil {
+		fields = make(Fields, len(lg.fields)+len(a.fields)+r.NumAttrs())
+	}
+	for k, v := range lg.fields {
+		fields[k] = v
+	}
+	for k, v := range a.fields {
+		fields[k] = v
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		addAttr(fields, a.prefix, attr)
+		return true
+	})
+	if len(fields) > 0 {
+		record.Fields = fields
+	}
+
+	lg.Handle(record)
+	return nil
+}
+
+// WithAttrs returns a new SlogAdapter with attrs added
+func (a *SlogAdapter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return a
+	}
+	fields := make(Fields, len(a.fields)+len(attrs))
+	for k, v := range a.fields {
+		fields[k] = v
+	}
+	for _, attr := range attrs {
+		addAttr(fields, a.prefix, attr)
+	}
+	return &SlogAdapter{logger: a.logger, fields: fields, prefix: a.prefix}
+}
+
+// WithGroup returns a new SlogAdapter whose attrs added later
+// are in group name
+func (a *SlogAdapter) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return a
+	}
+	return &SlogAdapter{logger: a.logger, fields: a.fields, prefix: a.prefix + name + "."}
+}
+
+// addAttr adds attr to fields with key prefixed, groups are flattened.
+// Attrs with empty key are ignored and groups with empty key are inlined
+// as slog.Handler requires.
+func addAttr(fields Fields, prefix string, attr slog.Attr) {
+	v := attr.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, a := range v.Group() {
+			addAttr(fields, prefix, a)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+	fields[prefix+attr.Key] = v.Any()
+}
+
+// SlogHandler is a handler which forwards records to a slog.Handler,
+// so that logdog's records are written by slog's handlers.
+//
+// Fields are converted to attrs, the name of logger is added as
+// the attr "logger". The caller is available to slog only if
+// runtime caller of the logger is enabled.
+//
+// Do not forward records to a slog.Handler logging back to logdog,
+// e.g. the default slog.Handler after slog.SetDefault(NewSlogLogger(root)).
+type SlogHandler struct {
+	Name    string
+	Level   Level
+	Handler slog.Handler
+	Filterer
+}
+
+// NewSlogHandler returns a new SlogHandler forwarding records to handler,
+// the handler of slog.Default() is used if it is nil
+func NewSlogHandler(handler slog.Handler, options ...Option) *SlogHandler {
+	if handler == nil {
+		handler = slog.Default().Handler()
+	}
+	hdlr := &SlogHandler{
+		Name:    "",
+		Level:   NothingLevel,
+		Handler: handler,
+	}
+
+	hdlr.ApplyOptions(options...)
+
+	return hdlr
+}
+
+// ApplyOptions applys all option to SlogHandler
+func (hdlr *SlogHandler) ApplyOptions(options ...Option) *SlogHandler {
+	ApplyOptionsTo(hdlr, options...)
+	return hdlr
+}
+
+// LoadConfig loads config from its input and
+// stores it in the value pointed to by c
+func (hdlr *SlogHandler) LoadConfig(c map[string]interface{}) error {
+	config, err := pythonic.DictReflect(c)
+	if err != nil {
+		return err
+	}
+
+	hdlr.Name = config.MustGetString("name", "")
+
+	hdlr.Level = GetLevel(config.MustGetString("level", "NOTHING"))
+
+	filters, err := LoadFilters(c)
+	if err != nil {
+		return err
+	}
+	hdlr.AddFilters(filters...)
+	if hdlr.LevelMask, err = LoadLevelMask(c); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Emit converts record to slog.Record and forwards it
+func (hdlr *SlogHandler) Emit(record *LogRecord) {
+	if hdlr.Filter(record) {
+		return
+	}
+
+	ctx := context.Background()
+	level := ToSlogLevel(record.Level)
+	if !hdlr.Handler.Enabled(ctx, level) {
+		return
+	}
+
+	r := slog.NewRecord(record.Time, level, record.GetMessage(), record.PC)
+	if record.Name != "" {
+		r.AddAttrs(slog.String("logger", record.Name))
+	}
+
+	keys := make([]string, 0, len(record.Fields))
+	for k := range record.Fields {
+		if !hasTypedField(record.TypedFields, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r.AddAttrs(slog.Any(k, record.Fields[k]))
+	}
+	for _, f := range record.TypedFields {
+		if f.Type != SkipType {
+			r.AddAttrs(fieldToAttr(f))
+		}
+	}
+
+	if err := hdlr.Handler.Handle(ctx, r); err != nil {
+		fmt.Fprintf(os.Stderr, "Forward record to slog handler failed, [%v]\n", err)
+	}
+}
+
+// Enabled checks if handler and the slog.Handler take records at level
+func (hdlr *SlogHandler) Enabled(level Level) bool {
+	return level >= hdlr.Level && hdlr.LevelMask.Contains(level) &&
+		hdlr.Handler.Enabled(context.Background(), ToSlogLevel(level))
+}
+
+// Filter checks if handler should filter the specified record
+func (hdlr *SlogHandler) Filter(record *LogRecord) bool {
+	return record.Level < hdlr.Level || hdlr.Filterer.Filter(record)
+}
+
+// Flush does nothing, slog.Handler has no flush method
+func (hdlr *SlogHandler) Flush() error {
+	return nil
+}
+
+// Close does nothing, slog.Handler has no close method
+func (hdlr *SlogHandler) Close() error {
+	return nil
+}
+
+// fieldToAttr converts typed field to slog.Attr,
+// nested objects are converted to groups
+func fieldToAttr(f Field) slog.Attr {
+	switch f.Type {
+	case StringType:
+		return slog.String(f.Key, f.String)
+	case Int64Type:
+		return slog.Int64(f.Key, f.Integer)
+	case Uint64Type:
+		return slog.Uint64(f.Key, uint64(f.Integer))
+	case Float64Type, BoolType, TimeType, ErrorType, AnyType:
+		return slog.Any(f.Key, f.Value())
+	case DurationType:
+		return slog.Duration(f.Key, time.Duration(f.Integer))
+	case StringerType:
+		return slog.String(f.Key, f.Interface.(fmt.Stringer).String())
+	case ObjectType:
+		enc := &attrEncoder{}
+		if err := f.Interface.(ObjectMarshaler).MarshalLogObject(enc); err != nil {
+			enc.AddField(NamedErr("error", err))
+		}
+		return slog.Attr{Key: f.Key, Value: slog.GroupValue(enc.attrs...)}
+	}
+	return slog.Any(f.Key, f.Interface)
+}
+
+// attrEncoder collects fields of a nested object as attrs
+type attrEncoder struct {
+	attrs []slog.Attr
+}
+
+func (enc *attrEncoder) AddField(f Field) {
+	if f.Type != SkipType {
+		enc.attrs = append(enc.attrs, fieldToAttr(f))
+	}
+}
+
+func init() {
+	RegisterConstructor("SlogHandler", func() ConfigLoader {
+		return NewSlogHandler(nil)
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLevel(t *testing.T) {
+	for _, level := range []Level{DebugLevel, InfoLevel, WarnLevel, ErrorLevel, NoticeLevel, FatalLevel} {
+		assert.Equal(t, level, FromSlogLevel(ToSlogLevel(level)), level.String())
+	}
+	assert.Equal(t, slog.LevelInfo, ToSlogLevel(InfoLevel))
+	assert.Equal(t, DebugLevel, FromSlogLevel(slog.LevelDebug-4))
+	assert.Equal(t, InfoLevel, FromSlogLevel(slog.LevelInfo+2))
+	assert.Equal(t, FatalLevel, FromSlogLevel(slog.LevelError+8))
+}
+
+func TestSlogAdapter(t *testing.T) {
+	hdlr := &recordHandler{}
+	logger := NewLogger(OptionName("slog"), OptionHandlers(hdlr), InfoLevel).
+		With(Fields{"bound": 1, "a": "overridden"})
+	slogger := NewSlogLogger(logger)
+
+	slogger.Debug("filtered")
+	assert.False(t, slogger.Enabled(nil, slog.LevelDebug))
+	slogger.With("a", "b").WithGroup("req").With("id", 1).
+		Warn("100%", "path", "/", slog.Group("user", "name", "jim"), slog.Group("", "inline", true), slog.Group("empty"))
+
+	if assert.Len(t, hdlr.records, 1) {
+		record := hdlr.records[0]
+		assert.Equal(t, "slog", record.Name)
+		assert.Equal(t, WarnLevel, record.Level)
+		assert.Equal(t, "100%", record.GetMessage())
+		assert.Equal(t, "slog_test.go", record.FileName)
+		assert.Equal(t, "TestSlogAdapter", record.ShortFuncName)
+		assert.NotZero(t, record.PC)
+		assert.Equal(t, Fields{
+			"bound":         1,
+			"a":             "b",
+			"req.id":        int64(1),
+			"req.path":      "/",
+			"req.user.name": "jim",
+			"req.inline":    true,
+		}, record.Fields)
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	jsonHandler := slog.NewJSONHandler(buf, &slog.HandlerOptions{AddSource: true, Level: slog.LevelInfo})
+	hdlr := NewSlogHandler(jsonHandler)
+	logger := NewLogger(OptionName("forward"), OptionHandlers(hdlr), OptionEnableRuntimeCaller(true), OptionCallerStackDepth(2))
+
+	assert.False(t, hdlr.Enabled(DebugLevel))
+	assert.False(t, logger.Enabled(DebugLevel))
+	logger.Debug("filtered by slog handler")
+	logger.Noticef("hello %s", "slog", Fields{"a": 1}, Duration("elapsed", time.Second), Object("user", user{1, "jim"}))
+
+	data := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &data))
+	assert.Equal(t, "ERROR+2", data["level"])
+	assert.Equal(t, "hello slog", data["msg"])
+	assert.Equal(t, "forward", data["logger"])
+	assert.Equal(t, 1.0, data["a"])
+	assert.Equal(t, float64(time.Second), data["elapsed"])
+	assert.Equal(t, map[string]interface{}{"id": 1.0, "name": "jim"}, data["user"])
+	source, _ := data["source"].(map[string]interface{})
+	assert.Contains(t, source["file"], "slog_test.go")
+	assert.Contains(t, source["function"], "TestSlogHandler")
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+const (
+	// maxStackDepth is the max number of frames in a stack trace
+	maxStackDepth = 64
+)
+
+// stackMarker is the type of WithStack
+type stackMarker struct{}
+
+// WithStack asks the logger to capture the stack trace of the logging call
+// on demand, no matter what StackLevel is. Like Fields, it must be at the
+// end of args, e.g.
+//
+//	logger.Warn("slow query", logdog.WithStack)
+var WithStack = stackMarker{}
+
+// takeStack returns the stack trace of the goroutine formatted like
+// runtime/debug.Stack, skip is the number of frames to skip
+// with 0 identifying the caller of takeStack
+func takeStack(skip int) string {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	b := []byte{}
+	for {
+		frame, more := frames.Next()
+		b = append(b, frame.Function...)
+		b = append(b, "\n\t"...)
+		b = append(b, frame.File...)
+		b = append(b, ':')
+		b = strconv.AppendInt(b, int64(frame.Line), 10)
+		if !more {
+			break
+		}
+		b = append(b, '\n')
+	}
+	return string(b)
+}
+
+// ErrorChain returns the errors wrapped by err in depth-first order,
+// both errors.Unwrap and errors.Join are walked. err itself is not included.
+func ErrorChain(err error) []error {
+	var chain []error
+	var walk func(err error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			if inner := e.Unwrap(); inner != nil {
+				chain = append(chain, inner)
+				walk(inner)
+			}
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				if inner != nil {
+					chain = append(chain, inner)
+					walk(inner)
+				}
+			}
+		}
+	}
+	if err != nil {
+		walk(err)
+	}
+	return chain
+}
+
+// errorType returns the type name of err, e.g. *errors.errorString
+func errorType(err error) string {
+	return fmt.Sprintf("%T", err)
+}
+
+// findError returns the first error in args, then the first typed
+// error field, it returns nil if there is not any
+func findError(args []interface{}, typed []Field) error {
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			return err
+		}
+	}
+	for _, f := range typed {
+		if f.Type == ErrorType {
+			return f.Interface.(error)
+		}
+	}
+	return nil
+}
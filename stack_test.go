@@ -0,0 +1,99 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorChain(t *testing.T) {
+	root := errors.New("root")
+	other := errors.New("other")
+	wrapped := fmt.Errorf("query: %w", root)
+	joined := errors.Join(wrapped, other)
+	err := fmt.Errorf("handle: %w", joined)
+
+	assert.Equal(t, []error{joined, wrapped, root, other}, ErrorChain(err))
+	assert.Nil(t, ErrorChain(root))
+	assert.Nil(t, ErrorChain(nil))
+
+	assert.Equal(t, "root", formatError(root))
+	assert.Equal(t, "query: root (caused by: root)", formatError(wrapped))
+	assert.Equal(t, "", formatError(nil))
+}
+
+func TestRecordError(t *testing.T) {
+	err := errors.New("boom")
+	record := NewLogRecord(name, level, pathname, fun, line, "failed: %v", err, String("k", "v"))
+	assert.Equal(t, err, record.Error)
+
+	record = NewLogRecord(name, level, pathname, fun, line, "failed", Err(err))
+	assert.Equal(t, err, record.Error)
+
+	record = NewLogRecord(name, level, pathname, fun, line, "ok", Err(nil))
+	assert.Nil(t, record.Error)
+}
+
+func TestStackTrace(t *testing.T) {
+	hdlr := &recordHandler{}
+	logger := NewLogger(OptionHandlers(hdlr), OptionStackLevel(ErrorLevel))
+
+	logger.Warn("no stack")
+	logger.Warn("stack on demand", WithStack)
+	logger.Error("stack by level")
+
+	assert.Equal(t, []string{"no stack", "stack on demand", "stack by level"}, hdlr.messages)
+	assert.Empty(t, hdlr.records[0].Stack)
+	for _, record := range hdlr.records[1:] {
+		// the first frame is the caller
+		assert.True(t, strings.HasPrefix(record.Stack, "github.com/zoumo/logdog.TestStackTrace\n\t"), record.Stack)
+		assert.Contains(t, record.Stack, "stack_test.go:")
+	}
+
+	// child inherits StackLevel
+	logger.With(Fields{"a": 1}).Error("child")
+	assert.NotEmpty(t, hdlr.records[3].Stack)
+}
+
+func TestFormatErrorAndStack(t *testing.T) {
+	err := fmt.Errorf("handle: %w", errors.New("root"))
+	record := NewLogRecord(name, ErrorLevel, pathname, fun, line, "failed: %v", err)
+	record.Stack = "main.main\n\tmain.go:1"
+
+	text, _ := (&TextFormatter{Fmt: "%(message) | %(error)%(stack)"}).Format(record)
+	assert.Equal(t, "failed: handle: root | handle: root (caused by: root)\nmain.main\n\tmain.go:1", text)
+
+	text, _ = NewJSONFormatter().Format(record)
+	data := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(text), &data))
+	assert.Equal(t, map[string]interface{}{
+		"message": "handle: root",
+		"type":    "*fmt.wrapError",
+		"chain": []interface{}{
+			map[string]interface{}{"message": "root", "type": "*errors.errorString"},
+		},
+		"stack": "main.main\n\tmain.go:1",
+	}, data["error"])
+
+	record = NewLogRecord(name, InfoLevel, pathname, fun, line, "ok")
+	text, _ = NewJSONFormatter().Format(record)
+	assert.NotContains(t, text, "error")
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Writer is an io.WriteCloser which splits bytes written to it into
+// lines and logs each line as a record at Level by Logger.
+// An incomplete line is buffered until it is completed or Writer is closed.
+//
+// If Prefix or Flags is set, Writer parses each line as the output of
+// the standard log package with them, the prefix, date and time are
+// stripped and the file and line are used as the caller of record.
+type Writer struct {
+	Logger *Logger
+	Level  Level
+	// Prefix and Flags are the prefix and flags of log.Logger writing to Writer
+	Prefix string
+	Flags  int
+
+	// entries is true if each Write is a complete entry of log.Logger,
+	// which may contain newlines
+	entries bool
+	mu      sync.Mutex
+	buf     []byte
+}
+
+// NewWriter returns a Writer logging lines by logger at level
+func NewWriter(logger *Logger, level Level) *Writer {
+	return &Writer{
+		Logger: logger,
+		Level:  level,
+	}
+}
+
+// newStdWriter returns a Writer taking entries of log.Logger with flag log.Llongfile
+func newStdWriter(logger *Logger, level Level) *Writer {
+	w := NewWriter(logger, level)
+	w.Flags = log.Llongfile
+	w.entries = true
+	return w
+}
+
+// Write logs complete lines in p, the rest is buffered
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.entries {
+		w.emit(string(bytes.TrimSuffix(p, []byte("\n"))))
+		return len(p), nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(string(bytes.TrimSuffix(w.buf[:i], []byte("\r"))))
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) == 0 {
+		// release the underlying array
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// Close logs the buffered incomplete line
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.emit(string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
+
+// emit logs line, empty lines are ignored
+func (w *Writer) emit(line string) {
+	lg := w.Logger
+	if line == "" || !lg.Enabled(w.Level) {
+		return
+	}
+
+	msg, file, lineno := w.parse(line)
+	// the message is formatted, keep it away from Sprintf
+	record := NewLogRecord(lg.Name, w.Level, file, "??", lineno, "", msg)
+	if len(lg.fields) > 0 {
+		record.Fields = lg.mergeFields(nil)
+	}
+	lg.Handle(record)
+}
+
+// parse strips prefix, date and time in line by Prefix and Flags,
+// returns the message and the caller if it is in line
+func (w *Writer) parse(line string) (msg, file string, lineno int) {
+	file = "??"
+	if w.Flags&log.Lmsgprefix == 0 {
+		line = strings.TrimPrefix(line, w.Prefix)
+	}
+	if w.Flags&log.Ldate != 0 {
+		line = skipWord(line)
+	}
+	if w.Flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		line = skipWord(line)
+	}
+	if w.Flags&(log.Lshortfile|log.Llongfile) != 0 {
+		// file:line: message
+		if i := strings.Index(line, ": "); i > 0 {
+			if j := strings.LastIndexByte(line[:i], ':'); j > 0 {
+				if n, err := strconv.Atoi(line[j+1 : i]); err == nil {
+					file, lineno = line[:j], n
+					line = line[i+2:]
+				}
+			}
+		}
+	}
+	if w.Flags&log.Lmsgprefix != 0 {
+		line = strings.TrimPrefix(line, w.Prefix)
+	}
+	return line, file, lineno
+}
+
+// skipWord skips s to the byte after the first space
+func skipWord(s string) string {
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+// Writer returns an io.WriteCloser logging each line written to it
+// at level, it should be closed to log the last incomplete line
+func (lg *Logger) Writer(level Level) io.WriteCloser {
+	return NewWriter(lg, level)
+}
+
+// StdLogger returns a log.Logger logging by logger at level,
+// the caller of log.Logger is kept. It can be used by APIs like
+// http.Server.ErrorLog.
+func (lg *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(newStdWriter(lg, level), "", log.Llongfile)
+}
+
+// RedirectStdLog redirects the output of standard log package to
+// logger at level, the caller of log functions is kept.
+// It returns a function which restores the output, prefix and flags
+// of standard log package.
+func RedirectStdLog(logger *Logger, level Level) func() {
+	flags, prefix, out := log.Flags(), log.Prefix(), log.Writer()
+	log.SetFlags(log.Llongfile)
+	log.SetPrefix("")
+	log.SetOutput(newStdWriter(logger, level))
+	return func() {
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		log.SetOutput(out)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Jim Zhang (jim.zoumo@gmail.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdog
+
+import (
+	"fmt"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	hdlr := &recordHandler{}
+	logger := NewLogger(OptionHandlers(hdlr)).With(Fields{"from": "writer"})
+
+	w := logger.Writer(WarnLevel)
+	fmt.Fprint(w, "first line\r\nsecond")
+	fmt.Fprint(w, " line 100%\n\nthird")
+	assert.Equal(t, []string{"first line", "second line 100%"}, hdlr.messages)
+	w.Close()
+	assert.Equal(t, []string{"first line", "second line 100%", "third"}, hdlr.messages)
+
+	for _, record := range hdlr.records {
+		assert.Equal(t, WarnLevel, record.Level)
+		assert.Equal(t, Fields{"from": "writer"}, record.Fields)
+	}
+}
+
+func TestWriterParse(t *testing.T) {
+	for _, c := range []struct {
+		prefix string
+		flags  int
+		line   string
+		msg    string
+		file   string
+		lineno int
+	}{
+		{"", 0, "a: b", "a: b", "??", 0},
+		{"[app] ", log.LstdFlags, "[app] 2009/01/23 01:23:23 message", "message", "??", 0},
+		{"[app] ", log.LstdFlags | log.Lmicroseconds | log.Lshortfile, "[app] 2009/01/23 01:23:23.123123 d.go:23: a: b", "a: b", "d.go", 23},
+		{"[app] ", log.Ltime | log.Llongfile | log.Lmsgprefix, "01:23:23 /a/b/c/d.go:23: [app] message", "message", "/a/b/c/d.go", 23},
+		{"", log.Lshortfile, "not a caller: message", "not a caller: message", "??", 0},
+	} {
+		w := &Writer{Prefix: c.prefix, Flags: c.flags}
+		msg, file, lineno := w.parse(c.line)
+		assert.Equal(t, c.msg, msg, c.line)
+		assert.Equal(t, c.file, file, c.line)
+		assert.Equal(t, c.lineno, lineno, c.line)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	hdlr := &recordHandler{}
+	logger := NewLogger(OptionHandlers(hdlr), InfoLevel)
+
+	logger.StdLogger(DebugLevel).Print("filtered")
+	logger.StdLogger(ErrorLevel).Printf("multi\nline")
+	if assert.Len(t, hdlr.records, 1) {
+		record := hdlr.records[0]
+		assert.Equal(t, "multi\nline", record.GetMessage())
+		assert.Equal(t, ErrorLevel, record.Level)
+		assert.Equal(t, "writer_test.go", record.FileName)
+	}
+
+	restore := RedirectStdLog(logger, InfoLevel)
+	log.Println("redirected")
+	restore()
+	assert.Equal(t, []string{"multi\nline", "redirected"}, hdlr.messages)
+	assert.Equal(t, "writer_test.go", hdlr.records[1].FileName)
+	assert.Equal(t, log.LstdFlags, log.Flags())
+}